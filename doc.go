@@ -87,16 +87,17 @@ This downloads the source code for the two commands, and also all of their
 subordinate packages.  It also compiles and installs the commands and
 packages.
 
-Muk is a program that initializes files for digest2.  It requires astorb.dat
-for input and will attempt to download a copy if it is not found.  Because
+Muk is a program that initializes files for digest2.  It requires an orbit
+catalog, normally astorb.dat, for input and will attempt to download a copy if it is not found.  Because
 the download is time consuming, you may wish to use an existing copy of
 astorb.dat.
 
-   muk -h
+   digest2 paths
 
-shows the default value for the -a option, where muk looks for astorb.dat
-by default.  To avoid the download, you can copy or link astorb.dat to this
-location, or you can specify a different path or filename with -a.
+shows where muk looks for astorb.dat by default.  (See Configuring file
+locations below.)  To avoid the download, you can copy or link astorb.dat to
+one of these locations, or you can specify a different path or filename
+with -a.
 
 Run muk by typing,
 
@@ -113,6 +114,7 @@ arguments (or with invalid arguments) shows this usage prompt.
 
   Usage: digest2 [options] <obsfile>    Score observations in file.
          digest2 [options] -            Score observations from stdin.
+         digest2 [options] paths        Show file locations.
          digest2 -h                     Display help and quick reference.
          digest2 -v                     Display version and copyright.
 
@@ -121,6 +123,8 @@ arguments (or with invalid arguments) shows this usage prompt.
        -m <model-file>
        -o <obscode-file>
        -p <path>
+       -r                  reload files on SIGHUP
+       -w <interval>       reload files when changed, checking at interval
 
 The help information lists a quick reference to keywords and orbit classes
 allowed in the configuration file.  The configuration file is explained
@@ -134,10 +138,32 @@ command line or from stdin.
 
 It also reads from two other required data files and an optional configuration
 file.  The default location for these three files is different for the C and Go
-programs.  For the Go program, their initial location is determined by GOPATH.
-The full path to these files is shown at the end of the usage message.
-Type digest2 without command line arguments and read the default location as
-the -p default.
+programs.  For the Go program, files not specified on the command line are
+searched for in this order:
+
+  1. Directories listed in the environment variable DIGEST2_PATH, separated
+     as in PATH.
+  2. XDG base directories.  For digest2.config these are
+     $XDG_CONFIG_HOME/digest2 (default ~/.config/digest2) then digest2 under
+     each directory of $XDG_CONFIG_DIRS (default /etc/xdg).  For the data
+     files they are $XDG_DATA_HOME/digest2 (default ~/.local/share/digest2)
+     then digest2 under each directory of $XDG_DATA_DIRS (default
+     /usr/local/share:/usr/share).
+  3. The directory containing the digest2 executable.
+  4. For GOPATH builds, the digest2 source directory.
+
+The same search is used by muk for s3m.bin, s3m.dat, and astorb.dat.  Files
+that muk or digest2 create, digest2.gmodel and a downloaded digest2.obscodes,
+are written to the first directory of DIGEST2_PATH if it is set, otherwise
+to the XDG data home directory, so that they are found first.
+
+The command
+
+	digest2 paths
+
+lists each file with the locations searched, marking with * the one that
+will be used.  Command line options can be given with paths to see their
+effect.  To score observations in a file named "paths", use ./paths.
 
 You can maintain these three files in their default location or you can
 relocate them and specify their locations with command line options.
@@ -156,6 +182,42 @@ names but in the specified location.
 If you specify -p in combination with -c, -o, or -m, the path specified
 with the -c, -o, or -m option takes precedence.  That is, the path specified
 with -p is not joined with with a file name specified with -c, -o, or -m.
+When -p is specified, files are not searched for in other locations.
+
+Self-contained binary
+
+The model and obscode files can be compiled into the digest2 binary.
+With digest2.gmodel and digest2.obscodes in the digest2 source directory,
+
+	go generate ./internal/d2prog
+	go build -tags embed
+
+copies the two files into the internal/d2prog directory and builds a binary
+that contains them.  Files on disk still take precedence.  The embedded copy
+of a file is used only when the file is not found on disk and no location
+was specified with -m, -o, or -p.  In particular an embedded copy of the obscode file
+is used rather than downloading a copy from the Minor Planet Center.
+
+digest2 -v shows the source of each file, either a path or "embedded copy."
+
+Reloading files
+
+A digest2 process reading observations from a long running stream, as
+with -, can reload the model, obscode, and configuration files without
+restarting.  With -r, a SIGHUP signal triggers a reload.  With -w, the files
+are checked for changes at the interval given, for example -w 1m, and
+reloaded when one changes.  Both can be used together.
+
+Tracklets already dispatched for scoring are scored with the files in use
+when they were dispatched.  Later tracklets use the reloaded files.  Each
+reload is logged to stderr with a fingerprint of each file before and after,
+the first 12 hex digits of its SHA-256 hash.
+
+A reload is refused, and logged, if it would change the output columns.
+A new model must have the same partitions and orbit classes as the one in
+use and must have the NoID models named in the configuration.  Of the configuration file
+keywords, only obserr can change.  Other changes require a restart.  An
+obscode file is not downloaded on reload.
 
 
 File formats
@@ -165,11 +227,35 @@ observations in the MPC 80 column observation format and nothing else.
 The observations should be sorted first by designation and then by time
 of observation, and there should be at least two observations of each object.
 
+As an extension of the format, an object with a single observation can be
+scored if the observation is of a streak with measured motion.  A motion line
+follows the observation line, with the same designation in columns 1-12 and
+the letter m in column 15.  Columns 16-77 give, separated by white space, the
+rate of motion in arc seconds per minute and the position angle of motion in
+degrees east of north.  These can be followed by the uncertainties of the rate
+and position angle, in the same units.  For example,
+
+     K26A00X  C2026 01 05.31250 10 15 22.41 +12 31 05.2          19.8 V      F51
+     K26A00X  m 12.52 243.7 .25 1.5                                          F51
+
+Two endpoints for the motion vector are synthesized, separated by .02 day
+along the line of motion.  The uncertainties of motion are taken as an
+observational error of the endpoints, used if larger than that specified by
+obserr.  Motion lines of objects with more than one observation are ignored.
+Malformed motion lines, and motion lines that do not directly follow an
+observation of the same object, are reported on standard error and ignored.
+
 digest2.obscodes is a text file containing observatory codes in the standard
 MPC format.  If the file is missing, digest2 will access the Minor Planet
 Center web site and download a copy.  This normally happens the first time
 you run digest2 and is normally quick and is not noticeable.
 
+The download location can be changed with the environment variable
+DIGEST2_OBSCODES_URL, a comma separated list of http, https, or file URLs
+to try in order.  If the environment variable DIGEST2_OFFLINE is set to any
+non-empty value, digest2 never accesses the network.  File URLs are still
+used.  See the muk documentation for more on downloading.
+
 digest2.gmodel is a binary file generated by the program muk, as described
 above.  See the full documentation on muk with,
 
@@ -185,8 +271,14 @@ Allowable keywords:
    noheadings
    rms
    norms
+   unbound
+   nounbound
+   geo
+   nogeo
+   curvature
+   nocurvature
    raw
-   noid
+   noid [<model> ...]
    repeatable
    random
    obserr
@@ -194,10 +286,69 @@ Allowable keywords:
 
 Headings and the rms column can be turned off if desired.
 
+The keyword unbound adds two columns following RMS, Unb and U11, for
+screening interstellar objects.  They are the percentages of sampled orbits
+consistent with the observed motion that are unbound, with e >= 1, and that
+have e > 1.1.  Orbits are sampled evenly in log distance from .05 to 100 AU
+and in the angle of motion that determines the line of sight velocity, with
+hyperbolic excess velocity up to 50 km/s.  The figures do not depend on the
+population model, which contains no unbound orbits.  They are a measure of
+the sampled space, not a probability.  Slow moving objects at large distance
+can be unbound at low velocities and so tend to show high percentages.  Only
+a high percentage together with low class scores is notable.  The default is
+nounbound.
+
+The keyword geo adds a column Geo for recognizing artificial satellites and
+other objects in near-Earth space.  Orbits are searched for from about 1500 km
+to 100 AU from the observer.  Within the Earth's Hill sphere, .01 AU, the
+orbits are geocentric, beyond it heliocentric.  Each orbit is fit to all
+observations of the tracklet as seen from their sites, so that the parallax of
+a close object is taken into account.  A distance is consistent with the
+observations if an orbit there fits all of them within three times the
+observational error specified by obserr.  Geo is the percentage of consistent
+distances where the best fitting orbit is bound to the Earth.  A high Geo
+indicates a likely artificial satellite or temporarily captured object.
+Tracklets of distant objects with several observations spanning an hour or
+more generally rule out close distances by the lack of parallax and show Geo
+near 0.  A tracklet of only two observations can show no parallax and Geo is
+then not meaningful.  The default is nogeo.
+
+The keyword curvature prunes sampled orbits that do not fit all observations
+of the tracklet, within three times the observational error specified by
+obserr, as seen from their sites.  The search otherwise considers only the
+motion vector between two observations, or two synthesized from a fit, and
+ignores the curvature that a longer arc shows.  Arcs of several nights are
+then scored from orbits consistent with the whole arc and give sharper class
+scores.  Pruning needs at least three observations and a non-zero
+observational error.  Curvature adds a column Prn, following any Unb, U11
+and Geo, the percentage of sampled orbits pruned.  The default is
+nocurvature.
+
+Class scores are computed from heliocentric orbits at distances of .05 AU and
+more, as a population model of the solar system is not meaningful closer to
+the Earth.
+
 Keywords raw and noid determine the score produced as described below under
 Algorithm Outline. The default is noid.  If both keywords are present, both
 scores are output.
 
+A model file can contain more than one unknown population model, each built
+with a different criterion for which known orbits are readily identifiable.
+Models are named by their identification threshold, for example 10", 1',
+and 10'.  Command digest2 -v lists the models in the model file.  By default
+NoID scores use the first model.  Models can be selected by listing names
+after noid, and a NoID column is output for each, as in
+
+  noid 10" 1' 10'
+
+The name "all" selects all models in the model file.  When a class column
+has more than one score, the model names are shown as column headings.
+Other possibilities use the first model listed.
+
+Models may also be epoch specific, built for a series of dates.  For these,
+the scores use populations interpolated to the mean observation date of the
+tracklet.  Command digest2 -v shows the range of epochs.
+
 The keywords repeatable and random determine if program output is
 strictly repeatable or can vary slightly from one run to the next.
 The program uses a Monte Carlo method.  By default, the pseudo random
@@ -230,6 +381,11 @@ Orbit classes:
    NEO    NEO(q < 1.3)
    N22    NEO(H <= 22)
    N18    NEO(H <= 18)
+   PHA    PHA
+   Ati    Atira
+   Ate    Aten
+   Apo    Apollo
+   Amo    Amor
    MC     Mars Crosser
    Hun    Hungaria gr.
    Pho    Phocaea group
@@ -241,6 +397,39 @@ Orbit classes:
    Hil    Hilda group
    JTr    Jupiter tr.
    JFC    Jupiter Comet
+   Cen    Centaur
+   TNO    TNO(30 < a < 50)
+   SDO    Scattered disk
+   LPC    Long period cmt
+
+Atira, Aten, Apollo, and Amor are the NEO groups:  Atiras with Q < .983,
+Atens with a < 1 and Q > .983, Apollos with a >= 1 and q < 1.017, and
+Amors with 1.017 < q < 1.3.  Like LPC, they are present only in models
+built from a binned S3M that includes them.  The s3m.dat distributed with
+muk predates them.  Regenerate it with s3mbin to score NEO groups.
+
+PHA, potentially hazardous asteroids, are orbits with an Earth MOID, minimum
+orbit intersection distance, under .05 AU and H <= 22.  The MOID is computed
+from the full orbital elements of each orbit digest2 generates.  When the
+model has PHA, its score is output by default following N18.  Like the NEO
+groups, PHA is present only in models built from a binned S3M that includes
+it.
+
+Cen, TNO, and SDO are the outer solar system classes:  Centaurs with
+q >= 5.2 and a < 30.1, between the orbits of Jupiter and Neptune, classical
+and resonant trans-Neptunian objects with 30.1 <= a < 50 and e < .35, and
+scattered disk objects with a >= 30.1 and q >= 25 that are not in TNO.
+digest2 searches distances out to 100 AU and solves orbits of any semimajor
+axis, so slow distant movers are scored in these classes.  They are present
+only in models built from a binned S3M that includes them.
+
+The classes available are those of the model.  LPC, long period comets,
+with e > .9 and a period over 200 years or an unbound orbit, is present only
+in models built with the S3M long period comet population.  See the s3mbin
+option -lpc.  A model may also have classes defined by expressions on
+orbital elements, given to s3mbin with -classes.  These are listed in the
+config file by abbreviation or heading like the classes above.  Command
+digest2 -v lists the classes of the model.
 
 Listing an orbit class limits scoring to only the listed classes.
 Other possibilities are not computed or listed.  Either abbreviations or
@@ -255,7 +444,8 @@ Example 1:
   N18
   poss
 
-This is equivalent to default program behavior without a config file.
+This is equivalent to default program behavior without a config file, for
+a model without PHA.  With PHA in the model, the default includes it.
 
 Example 2:
 
@@ -328,9 +518,12 @@ solar system, but of the expected yet-undiscovered population.  This
 population is computed by reducing the modeled complete population by known
 discoveries.  As the intended context of the no-ID score is after attempted
 object identification, the selected known population is that which is readily
-identifiable.  The current criteria used is sky uncertainty < 1' arc.
+identifiable.  The default criterion is sky uncertainty <= 1' arc.
+See the muk documentation for building models with other criteria.
 The uncertainty parameter selected for this comparison is field 24 of
 astorb.dat, which is a peak ephemeris uncertainty over a 10 year period.
+When muk builds the model from an MPC catalog instead, the uncertainty
+parameter U is used, as described in the muk documentation.
 
 -------------
 Public domain 2014, Smithsonian Astrophysical Observatory.
@@ -1,16 +1,18 @@
-module "github.com/soniakeys/digest2"
+module github.com/soniakeys/digest2
+
+go 1.16
 
 require (
-	"github.com/soniakeys/astro" v1.0.0
-	"github.com/soniakeys/coord" v1.0.0
-	"github.com/soniakeys/exit" v1.0.0
-	"github.com/soniakeys/lmfit" v1.0.0
-	"github.com/soniakeys/meeus/v3" v3.0.0
-	"github.com/soniakeys/mpcformat" v1.0.0
-	"github.com/soniakeys/observation" v1.0.0
-	"github.com/soniakeys/sexagesimal" v1.0.0
-	"github.com/soniakeys/unit" v1.0.0
-	"golang.org/x/crypto" v0.0.0-20180228161326-91a49db82a88
-	"golang.org/x/exp" v0.0.0-20180214205018-83bc9a11ae1a
-	"golang.org/x/sys" v0.0.0-20180302081741-dd2ff4accc09
+	github.com/soniakeys/astro v1.0.0
+	github.com/soniakeys/coord v1.0.0
+	github.com/soniakeys/exit v1.0.0
+	github.com/soniakeys/lmfit v1.0.0
+	github.com/soniakeys/meeus/v3 v3.0.0
+	github.com/soniakeys/mpcformat v1.0.0
+	github.com/soniakeys/observation v1.0.0
+	github.com/soniakeys/sexagesimal v1.0.0
+	github.com/soniakeys/unit v1.0.0
+	golang.org/x/crypto v0.0.0-20180228161326-91a49db82a88
+	golang.org/x/exp v0.0.0-20180214205018-83bc9a11ae1a
+	golang.org/x/sys v0.0.0-20180302081741-dd2ff4accc09
 )
@@ -0,0 +1,56 @@
+/*
+Command heatmap draws digest2 model populations as SVG heatmaps.
+
+Usage
+
+Command line options:
+
+  heatmap [options] [output file]   Write SVG heatmap, default to stdout.
+  heatmap -v                        Display version and copyright.
+
+  -m <model file>   default digest2.gmodel, located as by digest2
+  -x <axis>         x axis, default q
+  -y <axis>         y axis, default e
+  -pop <pop>        complete or unknown population, default all
+  -c <class>        orbit class, default the complete population
+  -obs <obs file>   observations for a tracklet overlay
+  -d <desig>        designation of the tracklet, default the first one
+  -o <obscode file> default digest2.obscodes, located as by digest2
+  -epoch <date>     date yyyy-mm-dd, for epoch specific unknown models
+
+Axes are the model dimensions q, e, i, and H, and also a, semimajor axis.
+Population counts are summed over the two model dimensions not shown.
+Cells are drawn equal size by partition index and colored on a log scale
+covering four decades below the most populated cell.
+
+Values shown are model values as stored in digest2.gmodel, which muk scales
+by the inverse square root of bin volume.  They are useful for comparing
+regions of orbit space and for sanity checking muk output, but they are not
+object counts.
+
+Semimajor axis is not a model dimension.  On an a axis, bins are placed by
+the value of a at the center of the q and e bin, using the q partitions as
+the partitions of a.  Bins with a center e >= 1 are not shown.
+
+Population -pop all is the complete population.  -pop unk is the first
+unknown population model in the model file.  Other unknown models can be
+selected by name, for example -pop "10'".  For epoch specific models, the
+model with the epoch nearest -epoch is shown, by default the latest.
+
+Orbit classes can be given by abbreviation or heading, as in digest2
+configuration files.  See the digest2 documentation for the list.
+
+With -obs, digest2 orbit search is run on a tracklet and cells containing
+bins tagged by the search are outlined in red.  The search runs with the
+default observational error of 1 arc second and repeatable random numbers.
+
+Examples
+
+  heatmap > qe.svg
+  heatmap -x a -y i -pop unk -c NEO unk-neo.svg
+  heatmap -x q -y H -obs fmo.obs -d NE00030 ne30.svg
+
+-------------
+Public domain.
+*/
+package main
@@ -0,0 +1,219 @@
+// Public domain.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"time"
+
+	xrand "golang.org/x/exp/rand"
+
+	"github.com/soniakeys/digest2/internal/d2bin"
+	"github.com/soniakeys/digest2/internal/d2path"
+	"github.com/soniakeys/digest2/internal/d2plot"
+	"github.com/soniakeys/digest2/internal/d2solver"
+	"github.com/soniakeys/exit"
+	"github.com/soniakeys/mpcformat"
+	"github.com/soniakeys/observation"
+	"github.com/soniakeys/unit"
+)
+
+const versionString = "heatmap version 0.1 Go source."
+const copyrightString = "Public domain."
+
+func main() {
+	defer exit.Handler()
+
+	flag.Usage = func() {
+		os.Stderr.WriteString(`Usage:
+  heatmap [options] [output file]   Write SVG heatmap, default to stdout.
+  heatmap -v                        Display version and copyright.
+
+Options:
+`)
+		flag.PrintDefaults()
+		os.Stderr.WriteString(`
+For full documentation:
+   godoc heatmap
+`)
+	}
+	mPath := flag.String("m", "", "model file")
+	xAxis := flag.String("x", "q", "x axis, one of q, e, i, H, a")
+	yAxis := flag.String("y", "e", "y axis, one of q, e, i, H, a")
+	pop := flag.String("pop", "all", "population, all, unk, or unknown model name")
+	class := flag.String("c", "", "orbit class, default complete population")
+	obsPath := flag.String("obs", "", "observation file for tracklet overlay")
+	desig := flag.String("d", "", "designation of tracklet to overlay")
+	oPath := flag.String("o", "", "obscode file, used with -obs")
+	epoch := flag.String("epoch", "", "date yyyy-mm-dd for epoch specific models")
+	vers := flag.Bool("v", false, "display version and copyright")
+	flag.Parse()
+	if *vers {
+		fmt.Println(versionString)
+		fmt.Println(copyrightString)
+		os.Exit(0)
+	}
+	if flag.NArg() > 1 {
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	var p d2plot.Plot
+	var err error
+	if p.X, err = d2plot.ParseAxis(*xAxis); err != nil {
+		exit.Log(err)
+	}
+	if p.Y, err = d2plot.ParseAxis(*yAxis); err != nil {
+		exit.Log(err)
+	}
+	if *mPath == "" {
+		c, _ := d2path.Find(d2bin.Mfn, d2path.Data)
+		*mPath = c.Path
+	}
+	model, err := d2bin.ReadFile(*mPath)
+	if err != nil {
+		exit.Log(err)
+	}
+	var m *d2bin.Model
+	g := model.UnkIndex(*pop)
+	switch {
+	case *pop == "all":
+		m = &model.All
+		p.Title = "Complete population"
+	case *pop == "unk":
+		g = 0
+	case g < 0:
+		exit.Log(`Population must be "all", "unk", or an unknown model name.`)
+	}
+	if g >= 0 {
+		m, p.Title = unkModel(model, g, *epoch)
+	}
+	p.Pop = m.SS
+	cx := -1
+	if *class > "" {
+		for x, c := range d2bin.CList {
+			if *class == c.Abbr || *class == c.Heading {
+				cx = x
+				break
+			}
+		}
+		if cx < 0 {
+			if _, err := d2bin.LookupClasses([]string{*class}, nil); err == nil {
+				exit.Log("Orbit class not in model: " + *class)
+			}
+			exit.Log("Unknown orbit class: " + *class)
+		}
+		p.Pop = m.Class[cx]
+		p.Title += ", " + d2bin.CList[cx].Heading
+	}
+	if *obsPath > "" {
+		a := readArc(*obsPath, *oPath, *desig)
+		// the solver needs some class to compute in order to tag bins.
+		classCompute := []int{0}
+		if cx >= 0 {
+			classCompute[0] = cx
+		}
+		s := d2solver.New(model, classCompute, nil, unit.AngleFromSec(1))
+		rnd := xrand.New(&xrand.PCGSource{})
+		rnd.Seed(3)
+		p.Tags = s.Tags(a, vMag(a), rnd)
+		p.Title += ", tracklet " + a.Desig
+	}
+
+	var w io.Writer = os.Stdout
+	if flag.NArg() == 1 {
+		f, err := os.Create(flag.Arg(0))
+		if err != nil {
+			exit.Log(err)
+		}
+		defer f.Close()
+		w = f
+	}
+	if err := p.WriteSVG(w); err != nil {
+		exit.Log(err)
+	}
+}
+
+// unkModel selects the model of unknown model group g nearest the date
+// given as yyyy-mm-dd, or the latest if date is empty.  It returns the
+// model and a title for it.
+func unkModel(f *d2bin.File, g int, date string) (*d2bin.Model, string) {
+	ug := f.UnkGroups()[g]
+	title := "Unknown population " + ug.Name
+	x := len(ug.Models) - 1
+	if ug.Epochs[x] == 0 {
+		return &f.Unk[ug.Models[x]], title
+	}
+	if date > "" {
+		t, err := time.Parse("2006-01-02", date)
+		if err != nil {
+			exit.Log(err)
+		}
+		mjd := float64(t.Unix())/86400 + 40587
+		for i, e := range ug.Epochs {
+			if math.Abs(e-mjd) < math.Abs(ug.Epochs[x]-mjd) {
+				x = i
+			}
+		}
+	}
+	e := time.Unix(int64((ug.Epochs[x]-40587)*86400), 0).UTC()
+	return &f.Unk[ug.Models[x]], title + " at " + e.Format("2006-01-02")
+}
+
+// readArc reads observations and returns the arc with designation desig,
+// or the first arc if desig is empty.
+func readArc(obsPath, ocdPath, desig string) *observation.Arc {
+	if ocdPath == "" {
+		c, _ := d2path.Find("digest2.obscodes", d2path.Data)
+		ocdPath = c.Path
+	}
+	ocdMap, err := mpcformat.ReadObscodeDatFile(ocdPath)
+	if err != nil {
+		exit.Log(err)
+	}
+	f, err := os.Open(obsPath)
+	if err != nil {
+		exit.Log(err)
+	}
+	defer f.Close()
+	for s := mpcformat.ArcSplitter(f, ocdMap); ; {
+		a, err := s()
+		switch {
+		case err == io.EOF:
+			if desig == "" {
+				exit.Log("No tracklet found in " + obsPath)
+			}
+			exit.Log("Tracklet " + desig + " not found in " + obsPath)
+		case err != nil:
+			if _, ok := err.(mpcformat.ArcError); ok {
+				continue
+			}
+			exit.Log(err)
+		}
+		if len(a.Obs) >= 2 && (desig == "" || a.Desig == desig) {
+			return &observation.Arc{
+				Desig: a.Desig,
+				Obs:   append([]observation.VObs{}, a.Obs...),
+			}
+		}
+	}
+}
+
+// vMag averages magnitudes as digest2 does, defaulting to V=21.
+func vMag(a *observation.Arc) float64 {
+	var mSum, mCount float64
+	for _, obs := range a.Obs {
+		if m := obs.Meas(); m.VMag > 0 {
+			mSum += m.VMag
+			mCount++
+		}
+	}
+	if mCount > 0 {
+		return mSum / mCount
+	}
+	return 21
+}
@@ -0,0 +1,629 @@
+// Public domain.
+
+// Package catalog reads orbit catalogs used by muk for the known population.
+//
+// Three formats are supported and detected automatically:
+//
+//	astorb.dat, the Lowell fixed width format.
+//	MPCORB.DAT, the MPC fixed width format, with or without the header.
+//	MPCORB JSON, the MPC JSON format, such as mpcorb_extended.json.
+//
+// Gzip compressed input is detected and decompressed.  Fixed width lines
+// may have trailing white space or CRLF line endings.  Lines that can't be
+// used are reported as a ParseError giving the line number and field.
+package catalog
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/soniakeys/unit"
+)
+
+// Catalog formats, as returned by Reader.Format.
+const (
+	Astorb = "astorb.dat"
+	MPCORB = "MPCORB.DAT"
+	JSON   = "MPCORB JSON"
+)
+
+// Default uncertainty fields.
+const (
+	AstorbUncDefault = "gpeu"
+	MPCUncDefault    = "u"
+)
+
+// Orbit holds the catalog information muk uses for a known orbit.
+type Orbit struct {
+	A, E, H float64
+	I       unit.Angle
+	// Node and Peri are the longitude of the ascending node and argument
+	// of perihelion, J2000 ecliptic.  They are meaningful only when
+	// Angles is true.
+	Node, Peri unit.Angle
+	Angles     bool
+	// Unc is the ephemeris uncertainty in arc seconds.  It is the
+	// measure compared to the identifiability threshold.  It is
+	// meaningful only when UncOK is true.
+	Unc   float64
+	UncOK bool
+	// Hist holds ephemeris uncertainty at dates, for estimating uncertainty
+	// at other dates.  It is empty if not available.  See UncAt.
+	Hist []UncPoint
+	Rate float64 // rate of change of uncertainty at Hist[0], arcsec/day
+	// FirstObs is the date of the first observation, an MJD, or an
+	// estimate of it.  It is zero if not available.
+	FirstObs float64
+}
+
+// setAngles sets the node and argument of perihelion of o from fields in
+// degrees.  They are left unknown unless both parse.
+func (o *Orbit) setAngles(node, peri string) {
+	n, err := strconv.ParseFloat(node, 64)
+	if err != nil {
+		return
+	}
+	w, err := strconv.ParseFloat(peri, 64)
+	if err != nil {
+		return
+	}
+	o.Node, o.Peri = unit.AngleFromDeg(n), unit.AngleFromDeg(w)
+	o.Angles = true
+}
+
+// UncPoint is an ephemeris uncertainty in arc seconds at a date, an MJD.
+type UncPoint struct {
+	MJD, Unc float64
+}
+
+// UncAt estimates ephemeris uncertainty at date mjd from o.Hist.
+//
+// The estimate is piecewise linear between the points of Hist and constant
+// after the last.  Before the first, the uncertainty increases at the rate
+// of change given for the first point.  ok is false if there is no history.
+func (o *Orbit) UncAt(mjd float64) (unc float64, ok bool) {
+	h := o.Hist
+	if len(h) == 0 {
+		return 0, false
+	}
+	if mjd <= h[0].MJD {
+		return h[0].Unc + math.Abs(o.Rate)*(h[0].MJD-mjd), true
+	}
+	for x := 1; x < len(h); x++ {
+		if mjd <= h[x].MJD {
+			f := (mjd - h[x-1].MJD) / (h[x].MJD - h[x-1].MJD)
+			return h[x-1].Unc + f*(h[x].Unc-h[x-1].Unc), true
+		}
+	}
+	if len(h) == 1 && o.Rate > 0 {
+		return h[0].Unc + o.Rate*(mjd-h[0].MJD), true
+	}
+	return h[len(h)-1].Unc, true
+}
+
+// Options control reading.
+type Options struct {
+	// Unc is the name of the field used as the ephemeris uncertainty,
+	// empty for the catalog default.  See UncFields.
+	Unc string
+	// MinYear is the minimum year of the date associated with the
+	// uncertainty, where there is one.
+	MinYear int
+	// Hist requests uncertainty history, needed for epoch specific models.
+	// It is supported only for astorb.dat.
+	Hist bool
+}
+
+// UncFields gives the uncertainty fields of astorb.dat.  The MPC formats
+// have only MPCUncDefault, the uncertainty parameter U.
+var UncFields = []string{"ceu", "peu", "gpeu", "gpeu2"}
+
+// ParseError reports an orbit that can't be used.  Reading can continue
+// after a ParseError.
+type ParseError struct {
+	Line   int // line number, or for JSON, record number
+	Record bool
+	Field  string
+	Err    string
+}
+
+func (e *ParseError) Error() string {
+	u := "line"
+	if e.Record {
+		u = "record"
+	}
+	if e.Field == "" {
+		return fmt.Sprintf("%s %d: %s", u, e.Line, e.Err)
+	}
+	return fmt.Sprintf("%s %d: field %s: %s", u, e.Line, e.Field, e.Err)
+}
+
+// Reader reads orbits from a catalog.
+type Reader struct {
+	f   format
+	unc string
+}
+
+// format is implemented by the reader for each catalog format.
+type format interface {
+	next() (Orbit, error)
+	name() string
+}
+
+// NewReader detects the format of a catalog and returns a reader for it.
+//
+// A catalog starting with [ is taken to be MPC's JSON format.  A first
+// line at least as long as an astorb.dat record is taken as astorb.dat.
+// Anything else is read as MPCORB.DAT, with or without the header.
+//
+// An error is returned if the uncertainty field is not valid for the format.
+func NewReader(r io.Reader, opt Options) (*Reader, error) {
+	br := bufio.NewReaderSize(r, 1<<10)
+	if m, _ := br.Peek(2); len(m) == 2 && m[0] == 0x1f && m[1] == 0x8b {
+		zr, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+		br = bufio.NewReaderSize(zr, 1<<10)
+	}
+	// peek doesn't consume leading blanks, which are significant in
+	// the fixed width formats.
+	b, _ := br.Peek(512)
+	if t := strings.TrimSpace(string(b)); strings.HasPrefix(t, "[") {
+		if err := mpcUnc(opt, JSON); err != nil {
+			return nil, err
+		}
+		j, err := newJSONReader(br)
+		if err != nil {
+			return nil, err
+		}
+		return &Reader{j, MPCUncDefault}, nil
+	}
+	lr := &lineReader{br: br}
+	line, err := lr.read()
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	if len(line) >= astorbMinLen {
+		if opt.Unc == "" {
+			opt.Unc = AstorbUncDefault
+		}
+		c, ok := astorbUnc[opt.Unc]
+		if !ok {
+			return nil, fmt.Errorf("uncertainty field %s not valid for %s",
+				opt.Unc, Astorb)
+		}
+		return &Reader{&astorbReader{lineReader: lr, first: line,
+			uncCol: c.col, dateCol: c.dateCol, minYear: opt.MinYear,
+			hist: opt.Hist}, opt.Unc}, nil
+	}
+	if err := mpcUnc(opt, MPCORB); err != nil {
+		return nil, err
+	}
+	m := &mpcorbReader{lineReader: lr}
+	rd := &Reader{m, MPCUncDefault}
+	if strings.HasPrefix(line, "-----") {
+		return rd, nil // end of header
+	}
+	if isMPCORBRecord(line) {
+		m.first = line // no header
+		return rd, nil
+	}
+	// skip header
+	for {
+		line, err = lr.read()
+		if strings.HasPrefix(line, "-----") {
+			return rd, nil
+		}
+		if err != nil {
+			return nil, errors.New("unrecognized catalog format")
+		}
+	}
+}
+
+// Next returns the next orbit.
+//
+// At the end of the catalog it returns io.EOF.  An orbit that can't be
+// used is returned as a *ParseError.  Other errors are not recoverable.
+func (r *Reader) Next() (Orbit, error) { return r.f.next() }
+
+// Format returns the name of the catalog format.
+func (r *Reader) Format() string { return r.f.name() }
+
+// Uncertainty returns the name of the uncertainty field in use.
+func (r *Reader) Uncertainty() string { return r.unc }
+
+// lineReader reads lines, counting them and removing line endings and
+// trailing white space.
+type lineReader struct {
+	br *bufio.Reader
+	n  int
+}
+
+// read returns io.EOF only if there is no line.
+func (lr *lineReader) read() (string, error) {
+	line, err := lr.br.ReadString('\n')
+	if line == "" {
+		if err == nil {
+			err = io.EOF
+		}
+		return "", err
+	}
+	lr.n++
+	return strings.TrimRight(line, " \t\r\n"), nil
+}
+
+// fields extracts fixed width fields, recording the first error.
+type fields struct {
+	line string
+	ln   int
+	err  *ParseError
+}
+
+// get returns line[a:b], with surrounding blanks removed.  If the line is
+// too short or the field is blank, an error is recorded and "" returned.
+//
+// Numeric fields are right justified so trailing blanks removed from the
+// line never belong to a field.  A line shorter than b is truncated.
+func (f *fields) get(name string, a, b int) string {
+	if f.err != nil {
+		return ""
+	}
+	if b > len(f.line) {
+		f.fail(name, fmt.Sprintf("line too short, length %d", len(f.line)))
+		return ""
+	}
+	s := strings.TrimSpace(f.line[a:b])
+	if s == "" {
+		f.fail(name, "blank")
+	}
+	return s
+}
+
+// opt returns line[a:b] with surrounding blanks removed, or "" if the line
+// is too short.  No error is recorded.
+func (f *fields) opt(a, b int) string {
+	if b > len(f.line) {
+		return ""
+	}
+	return strings.TrimSpace(f.line[a:b])
+}
+
+func (f *fields) float(name string, a, b int) float64 {
+	s := f.get(name, a, b)
+	if f.err != nil {
+		return 0
+	}
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		f.fail(name, fmt.Sprintf("invalid number %q", s))
+	}
+	return v
+}
+
+// peu returns an astorb.dat uncertainty value starting at column c.
+func (f *fields) peu(name string, c int) float64 {
+	s := f.get(name, c, c+7)
+	if f.err != nil {
+		return 0
+	}
+	v, err := parsePEU(s)
+	if err != nil {
+		f.fail(name, fmt.Sprintf("invalid number %q", s))
+	}
+	return v
+}
+
+// parsePEU parses an astorb.dat uncertainty value, as in 1.2E+01.
+// Only the mantissa and exponent digits are used.
+func parsePEU(s string) (float64, error) {
+	if len(s) != 7 {
+		return 0, errors.New("invalid uncertainty")
+	}
+	return strconv.ParseFloat(s[:3]+"e"+s[4:], 64)
+}
+
+func (f *fields) fail(name, msg string) {
+	if f.err == nil {
+		f.err = &ParseError{Line: f.ln, Field: name, Err: msg}
+	}
+}
+
+// astorbUnc gives the columns of astorb.dat uncertainty fields and of the
+// date associated with each.
+var astorbUnc = map[string]struct{ col, dateCol int }{
+	"ceu":   {191, 208}, // current ephemeris uncertainty
+	"peu":   {217, 225}, // next peak ephemeris uncertainty
+	"gpeu":  {234, 242}, // greatest PEU in next 10 years
+	"gpeu2": {251, 259}, // greatest PEU in 10 years with 2 more obs
+}
+
+// astorbMinLen is a length that distinguishes astorb.dat lines from
+// MPCORB.DAT lines.  It is the end of the greatest PEU date year.
+const astorbMinLen = 246
+
+// mpcUnc validates options for the MPC formats.
+func mpcUnc(opt Options, format string) error {
+	if opt.Unc != "" && opt.Unc != MPCUncDefault {
+		return fmt.Errorf("uncertainty field %s not valid for %s",
+			opt.Unc, format)
+	}
+	if opt.Hist {
+		return fmt.Errorf("epoch models not supported for %s", format)
+	}
+	return nil
+}
+
+// astorbReader reads the Lowell astorb.dat format.
+//
+// Note on file size:  astorb.dat is over 100M.  I found that the
+// following bufio code ran about twice as fast as equivalent code
+// using ioutil.Readfile.  I usually like bufio.ReadLine, but that
+// seems to offer a big advantage only when you can work with bytes.
+// Here we need strconv functions, so bufio.ReadString seems best.
+//
+// Note also that astorb.data is ASCII encoded.
+type astorbReader struct {
+	*lineReader
+	first           string // first line, read during format detection
+	uncCol, dateCol int    // columns of the selected uncertainty field
+	minYear         int
+	hist            bool // parse uncertainty history
+}
+
+func (r *astorbReader) name() string { return Astorb }
+
+func (r *astorbReader) next() (o Orbit, err error) {
+	line := r.first
+	if line > "" {
+		r.first = ""
+	} else if line, err = r.read(); err != nil {
+		return
+	}
+	f := fields{line: line, ln: r.n}
+	// the uncertainty is considered valid only if the date associated
+	// with it is not before minYear.
+	if y, err := strconv.Atoi(f.opt(r.dateCol, r.dateCol+4)); err == nil &&
+		y >= r.minYear {
+		o.Unc = f.peu("uncertainty", r.uncCol)
+		o.UncOK = true
+	}
+	o.A = f.float("a", 169, 181)
+	o.E = f.float("e", 158, 168)
+	o.I = unit.AngleFromDeg(f.float("i", 147, 157))
+	o.H = f.float("H", 42, 47)
+	if f.err != nil {
+		return o, f.err
+	}
+	o.setAngles(f.opt(137, 147), f.opt(126, 136))
+	if r.hist {
+		o.Hist, o.Rate = astorbHist(&f)
+	}
+	// astorb.dat has no date of first observation.  estimate it as the
+	// date of orbit computation less the length of the observed arc.
+	if arc, err := strconv.Atoi(f.opt(95, 100)); err == nil {
+		if t, err := time.Parse("20060102", f.opt(182, 190)); err == nil {
+			o.FirstObs = TimeMJD(t) - float64(arc)
+		}
+	}
+	return o, nil
+}
+
+// astorbHist parses the current and peak ephemeris uncertainties and their
+// dates.  Points that don't parse or are out of date order are left out.
+// The history is empty if the current uncertainty doesn't parse.
+func astorbHist(f *fields) (h []UncPoint, rate float64) {
+	var err error
+	if rate, err = strconv.ParseFloat(f.opt(199, 207), 64); err != nil {
+		return
+	}
+	for _, fn := range []string{"ceu", "peu", "gpeu"} {
+		c := astorbUnc[fn]
+		unc, err := parsePEU(f.opt(c.col, c.col+7))
+		if err != nil {
+			if fn == "ceu" {
+				return nil, 0
+			}
+			continue
+		}
+		t, err := time.Parse("20060102", f.opt(c.dateCol, c.dateCol+8))
+		if err != nil {
+			if fn == "ceu" {
+				return nil, 0
+			}
+			continue
+		}
+		mjd := TimeMJD(t)
+		if len(h) > 0 && mjd <= h[len(h)-1].MJD {
+			continue
+		}
+		h = append(h, UncPoint{mjd, unc})
+	}
+	return
+}
+
+// TimeMJD converts a time to an MJD.
+func TimeMJD(t time.Time) float64 {
+	return float64(t.Unix())/86400 + 40587
+}
+
+// MJDTime converts an MJD to a time.
+func MJDTime(mjd float64) time.Time {
+	return time.Unix(int64(math.Round((mjd-40587)*86400)), 0).UTC()
+}
+
+// uArcsec is the upper bound of the ephemeris uncertainty, in arc seconds,
+// for each value of the MPC uncertainty parameter U.  U = 9 has no upper
+// bound.
+var uArcsec = [...]float64{1, 4.4, 19.6, 86.5, 382, 1692, 7488, 33121, 146502}
+
+// UncertaintyU maps the MPC uncertainty parameter to arc seconds.
+//
+// Values E, D, F, and blank indicate no uncertainty could be computed.
+// ok is false for these.
+func UncertaintyU(u string) (arcsec float64, ok bool) {
+	u = strings.TrimSpace(u)
+	if len(u) != 1 || u[0] < '0' || u[0] > '9' {
+		return 0, false
+	}
+	if u[0] == '9' {
+		return math.Inf(1), true
+	}
+	return uArcsec[u[0]-'0'], true
+}
+
+// mpcorbReader reads the MPC MPCORB.DAT fixed width format.
+type mpcorbReader struct {
+	*lineReader
+	first string
+}
+
+func (r *mpcorbReader) name() string { return MPCORB }
+
+// isMPCORBRecord does a quick check that a line looks like an orbit.
+func isMPCORBRecord(line string) bool {
+	if len(line) < 103 {
+		return false
+	}
+	_, err := strconv.ParseFloat(strings.TrimSpace(line[92:103]), 64)
+	return err == nil
+}
+
+func (r *mpcorbReader) next() (o Orbit, err error) {
+	line := r.first
+	if line > "" {
+		r.first = ""
+	} else {
+		// skip blank lines, which separate sections of the file
+		for line == "" {
+			if line, err = r.read(); err != nil {
+				return
+			}
+		}
+	}
+	f := fields{line: line, ln: r.n}
+	o.A = f.float("a", 92, 103)
+	o.E = f.float("e", 70, 79)
+	o.I = unit.AngleFromDeg(f.float("i", 59, 68))
+	o.H = f.float("H", 8, 13)
+	if f.err != nil {
+		return o, f.err
+	}
+	o.setAngles(f.opt(48, 57), f.opt(37, 46))
+	if len(line) > 105 {
+		o.Unc, o.UncOK = UncertaintyU(line[105:106])
+	}
+	o.FirstObs = mpcFirstObs(f.opt(127, 136), "", f.opt(194, 202))
+	return o, nil
+}
+
+// mpcFirstObs determines the date of first observation from MPC fields.
+//
+// For multi-opposition orbits, arc is "yyyy-yyyy" and the first year is
+// used, taken as the start of the year.  For single-opposition orbits arc
+// is "nnnn days" and the date is last less nnnn days.  days may be given
+// separately, as in the JSON format.  last is yyyymmdd or yyyy-mm-dd.
+// The result is zero if the date can't be determined.
+func mpcFirstObs(arc, days, last string) float64 {
+	arc = strings.TrimSpace(arc)
+	if len(arc) == 9 && arc[4] == '-' {
+		if t, err := time.Parse("2006", arc[:4]); err == nil {
+			return TimeMJD(t)
+		}
+		return 0
+	}
+	if f := strings.Fields(arc); len(f) == 2 && f[1] == "days" {
+		days = f[0]
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(days))
+	if err != nil {
+		return 0
+	}
+	last = strings.Replace(strings.TrimSpace(last), "-", "", -1)
+	t, err := time.Parse("20060102", last)
+	if err != nil {
+		return 0
+	}
+	return TimeMJD(t) - float64(n)
+}
+
+// jsonReader reads MPC's MPCORB JSON format, an array of objects.
+type jsonReader struct {
+	dec *json.Decoder
+	n   int // record number
+}
+
+func (r *jsonReader) name() string { return JSON }
+
+func newJSONReader(rd io.Reader) (*jsonReader, error) {
+	dec := json.NewDecoder(rd)
+	if _, err := dec.Token(); err != nil { // opening [
+		return nil, err
+	}
+	return &jsonReader{dec: dec}, nil
+}
+
+// jsonOrbit holds the fields used from a JSON orbit.  Pointers detect
+// missing fields.  U is given as a string in MPC files but a number is
+// accepted as well.
+type jsonOrbit struct {
+	A         *float64    `json:"a"`
+	E         *float64    `json:"e"`
+	I         *float64    `json:"i"`
+	H         *float64    `json:"H"`
+	Node      *float64    `json:"Node"`
+	Peri      *float64    `json:"Peri"`
+	U         interface{} `json:"U"`
+	ArcYears  string      `json:"Arc_years"`
+	ArcLength interface{} `json:"Arc_length"`
+	LastObs   string      `json:"Last_obs"`
+}
+
+func (r *jsonReader) next() (o Orbit, err error) {
+	if !r.dec.More() {
+		return o, io.EOF
+	}
+	r.n++
+	var j jsonOrbit
+	if err = r.dec.Decode(&j); err != nil {
+		if te, ok := err.(*json.UnmarshalTypeError); ok {
+			return o, &ParseError{Line: r.n, Record: true, Field: te.Field,
+				Err: "invalid type " + te.Value}
+		}
+		return // syntax errors are not recoverable
+	}
+	for _, f := range []struct {
+		name string
+		v    *float64
+	}{{"a", j.A}, {"e", j.E}, {"i", j.I}, {"H", j.H}} {
+		if f.v == nil {
+			return o, &ParseError{Line: r.n, Record: true, Field: f.name,
+				Err: "missing"}
+		}
+	}
+	o.A, o.E, o.I, o.H = *j.A, *j.E, unit.AngleFromDeg(*j.I), *j.H
+	if j.Node != nil && j.Peri != nil {
+		o.Node, o.Peri = unit.AngleFromDeg(*j.Node), unit.AngleFromDeg(*j.Peri)
+		o.Angles = true
+	}
+	switch u := j.U.(type) {
+	case string:
+		o.Unc, o.UncOK = UncertaintyU(u)
+	case float64:
+		o.Unc, o.UncOK = UncertaintyU(fmt.Sprint(u))
+	}
+	var days string
+	if j.ArcLength != nil {
+		days = fmt.Sprint(j.ArcLength)
+	}
+	o.FirstObs = mpcFirstObs(j.ArcYears, days, j.LastObs)
+	return o, nil
+}
@@ -0,0 +1,223 @@
+// Public domain.
+
+package catalog_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/soniakeys/digest2/internal/catalog"
+)
+
+// line builds a fixed width line from fields at 0-based columns.
+func line(n int, f map[int]string) string {
+	b := []byte(strings.Repeat(" ", n))
+	for c, s := range f {
+		copy(b[c:], s)
+	}
+	return string(b)
+}
+
+func astorbLine(h, a string) string {
+	return line(267, map[int]string{
+		42:  h,
+		95:  " 1000",
+		126: "  73.92320",
+		137: "  80.27219",
+		147: "  10.58000",
+		158: "0.07940000",
+		169: a,
+		182: "20100101",
+		191: "1.0E+00",
+		199: " 1.0E-02",
+		208: "20100101",
+		217: "1.0E+02",
+		225: "20150101",
+		234: "5.0E+01",
+		242: "20200101",
+		251: "2.0E+01",
+		259: "20200101",
+	})
+}
+
+func mpcorbLine(h, a, u, arc, last string) string {
+	return line(202, map[int]string{
+		8:   h,
+		37:  " 73.42179",
+		48:  " 80.25496",
+		59:  " 10.58780",
+		70:  "0.0794013",
+		92:  a,
+		105: u,
+		127: arc,
+		194: last,
+	})
+}
+
+// readAll reads a catalog, returning orbits and parse errors.
+func readAll(t *testing.T, r io.Reader, opt catalog.Options) (*catalog.Reader, []catalog.Orbit, []string) {
+	cr, err := catalog.NewReader(r, opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var orbits []catalog.Orbit
+	var errs []string
+	for {
+		o, err := cr.Next()
+		switch err.(type) {
+		case nil:
+			orbits = append(orbits, o)
+			continue
+		case *catalog.ParseError:
+			errs = append(errs, err.Error())
+			continue
+		}
+		if err != io.EOF {
+			t.Fatal(err)
+		}
+		return cr, orbits, errs
+	}
+}
+
+func TestAstorb(t *testing.T) {
+	good := astorbLine(" 3.34", "   2.7660000")
+	cat := good + "   \r\n" + // trailing white space, CRLF
+		astorbLine(" 3.34", "     2.x    ") + "\n" +
+		good[:175] + "\n" + // truncated
+		astorbLine("     ", "   2.7660000") + "\n" +
+		good // no final newline
+	var gz bytes.Buffer
+	w := gzip.NewWriter(&gz)
+	io.WriteString(w, cat)
+	w.Close()
+	for _, r := range []io.Reader{strings.NewReader(cat), &gz} {
+		cr, orbits, errs := readAll(t, r, catalog.Options{MinYear: 2000})
+		if cr.Format() != catalog.Astorb || cr.Uncertainty() != "gpeu" {
+			t.Fatal(cr.Format(), cr.Uncertainty())
+		}
+		want := []string{
+			`line 2: field a: invalid number "2.x"`,
+			"line 3: field a: line too short, length 175",
+			"line 4: field H: blank",
+		}
+		if fmt.Sprint(errs) != fmt.Sprint(want) {
+			t.Fatal(errs)
+		}
+		if len(orbits) != 2 {
+			t.Fatal(len(orbits), "orbits")
+		}
+		o := orbits[0]
+		if o.A != 2.766 || o.H != 3.34 || !o.UncOK || o.Unc != 50 ||
+			o.FirstObs != 55197-1000 || !o.Angles ||
+			math.Abs(o.Peri.Deg()-73.9232) > 1e-9 ||
+			math.Abs(o.Node.Deg()-80.27219) > 1e-9 {
+			t.Fatalf("%+v", o)
+		}
+	}
+}
+
+func TestAstorbOptions(t *testing.T) {
+	l := astorbLine(" 3.34", "   2.7660000")
+	_, o, _ := readAll(t, strings.NewReader(l),
+		catalog.Options{Unc: "gpeu2", MinYear: 2021, Hist: true})
+	if o[0].UncOK {
+		t.Fatal("uncertainty date before MinYear accepted")
+	}
+	if len(o[0].Hist) != 3 {
+		t.Fatal("history", o[0].Hist)
+	}
+	if _, err := catalog.NewReader(strings.NewReader(l),
+		catalog.Options{Unc: "u"}); err == nil {
+		t.Fatal("invalid field accepted")
+	}
+}
+
+func TestMPCORB(t *testing.T) {
+	cat := "MPCORB.DAT header\r\n" + strings.Repeat("-", 160) + "\r\n" +
+		mpcorbLine(" 3.34", "  2.7660512", "0", "1801-2024", "20241101") + "\r\n" +
+		"\r\n" + // blank line between sections
+		mpcorbLine("21.50", "  1.2660512", "E", "  30 days", "20241101") + "\r\n" +
+		mpcorbLine("21.50", "           ", "E", "  30 days", "20241101") + "\r\n"
+	cr, orbits, errs := readAll(t, strings.NewReader(cat), catalog.Options{})
+	if cr.Format() != catalog.MPCORB {
+		t.Fatal(cr.Format())
+	}
+	if len(errs) != 1 || errs[0] != "line 6: field a: blank" {
+		t.Fatal(errs)
+	}
+	if len(orbits) != 2 || !orbits[0].UncOK || orbits[0].Unc != 1 ||
+		orbits[1].UncOK || !orbits[0].Angles ||
+		math.Abs(orbits[0].Node.Deg()-80.25496) > 1e-9 {
+		t.Fatalf("%+v", orbits)
+	}
+	if orbits[0].FirstObs != -21139 || orbits[1].FirstObs != 60615-30 {
+		t.Fatal(orbits[0].FirstObs, orbits[1].FirstObs)
+	}
+	if _, err := catalog.NewReader(strings.NewReader(cat),
+		catalog.Options{Hist: true}); err == nil {
+		t.Fatal("history accepted for MPCORB")
+	}
+}
+
+func TestJSON(t *testing.T) {
+	cat := ` [
+{"a":2.766,"e":0.079,"i":10.58,"H":3.34,"U":"0","Arc_years":"1801-2024",
+	"Node":80.25,"Peri":73.42},
+{"a":1.26,"e":0.479,"i":10.5,"U":2},
+{"a":"x","e":0.4,"i":1,"H":2},
+{"a":1.26,"e":0.479,"i":10.5,"H":21.5,"U":2,
+	"Arc_length":30,"Last_obs":"2024-11-01"}
+]`
+	cr, orbits, errs := readAll(t, strings.NewReader(cat), catalog.Options{})
+	if cr.Format() != catalog.JSON {
+		t.Fatal(cr.Format())
+	}
+	want := []string{
+		"record 2: field H: missing",
+		"record 3: field a: invalid type string",
+	}
+	if fmt.Sprint(errs) != fmt.Sprint(want) {
+		t.Fatal(errs)
+	}
+	if len(orbits) != 2 || orbits[1].Unc != 19.6 ||
+		orbits[1].FirstObs != 60615-30 ||
+		!orbits[0].Angles || orbits[1].Angles {
+		t.Fatalf("%+v", orbits)
+	}
+}
+
+func TestUncAt(t *testing.T) {
+	o := catalog.Orbit{
+		Hist: []catalog.UncPoint{{100, 1}, {200, 11}, {300, 5}},
+		Rate: .5,
+	}
+	for _, tc := range []struct{ mjd, unc float64 }{
+		{90, 6}, {150, 6}, {250, 8}, {400, 5},
+	} {
+		if u, ok := o.UncAt(tc.mjd); !ok || u != tc.unc {
+			t.Fatal(tc.mjd, u)
+		}
+	}
+	if _, ok := (&catalog.Orbit{}).UncAt(0); ok {
+		t.Fatal("no history")
+	}
+}
+
+func ExampleUncertaintyU() {
+	for _, u := range []string{"0", "2", "3", "9", "E", " "} {
+		a, ok := catalog.UncertaintyU(u)
+		fmt.Printf("%q %g %t\n", u, a, ok && !math.IsInf(a, 1))
+	}
+	// Output:
+	// "0" 1 true
+	// "2" 19.6 true
+	// "3" 86.5 true
+	// "9" +Inf false
+	// "E" 0 false
+	// " " 0 false
+}
@@ -5,10 +5,8 @@
 package d2bin
 
 import (
-	"encoding/gob"
+	"fmt"
 	"math"
-	"os"
-	"time"
 
 	"github.com/soniakeys/unit"
 )
@@ -38,39 +36,6 @@ func New() *Model {
 	return &m
 }
 
-// ReadFile reads a population model.
-//
-// Argument fn is the filename of the model file created by muk.
-//
-// The model is returned in all and unk, also package variables QPart, EPart,
-// IPart, HPart, MSize, and LastH are set.
-func ReadFile(fn string) (all, unk Model, aoDate time.Time, aoLines int, err error) {
-	var f *os.File
-	f, err = os.Open(fn)
-	if err != nil {
-		return
-	}
-	defer f.Close()
-	dec := gob.NewDecoder(f)
-	if err = dec.Decode(&aoDate); err != nil {
-		return
-	}
-	if err = dec.Decode(&aoLines); err != nil {
-		return
-	}
-	if err = dec.Decode(&QPart); err != nil {
-		return
-	}
-	dec.Decode(&EPart)
-	dec.Decode(&IPart)
-	dec.Decode(&HPart)
-	dec.Decode(&MSize)
-	dec.Decode(&LastH)
-	dec.Decode(&all)
-	err = dec.Decode(&unk)
-	return
-}
-
 // Package variables that define the shape and size of the model.  They are
 // constant after being set (in s3mbin) or loaded (in muk and digest2.)
 var (
@@ -125,15 +90,30 @@ func H(h float64) (ih int) {
 	return
 }
 
-// Clist represents the modeled orbit classes
-var CList = []struct {
+// Class is an orbit class.
+type Class struct {
 	Abbr, Heading string
-	IsClass       func(q, e float64, i unit.Angle, h float64) bool
-}{
+	IsClass       func(o *Orbit) bool
+}
+
+// CList represents the modeled orbit classes.
+//
+// Like the partitions, it is set when a model is loaded, from the classes
+// stored in the model file.  It is initially all of Classes.
+var CList = Classes
+
+// Classes lists the built in orbit classes.  A model may have any of them,
+// and classes defined by ClassDefs.
+var Classes = []Class{
 	{"Int", "MPC interest.", isMpcint},
 	{"NEO", "NEO(q < 1.3)", isNeo},
 	{"N22", "NEO(H <= 22)", isCMO},
 	{"N18", "NEO(H <= 18)", isH18Neo},
+	{"PHA", "PHA", isPHA},
+	{"Ati", "Atira", isAtira},
+	{"Ate", "Aten", isAten},
+	{"Apo", "Apollo", isApollo},
+	{"Amo", "Amor", isAmor},
 	{"MC", "Mars Crosser", isMarsCrosser},
 	{"Hun", "Hungaria gr.", isHungaria},
 	{"Pho", "Phocaea group", isPhocaea},
@@ -145,136 +125,281 @@ var CList = []struct {
 	{"Hil", "Hilda group", isHilda},
 	{"JTr", "Jupiter tr.", isTrojan},
 	{"JFC", "Jupiter Comet", isJFC},
+	{"Cen", "Centaur", isCentaur},
+	{"TNO", "TNO(30 < a < 50)", isTNO},
+	{"SDO", "Scattered disk", isSDO},
+	{"LPC", "Long period cmt", isLPC},
+}
+
+// v2Classes are the classes of model files that do not list their classes.
+var v2Classes = []string{"Int", "NEO", "N22", "N18", "MC", "Hun", "Pho",
+	"MB1", "Pal", "Han", "MB2", "MB3", "Hil", "JTr", "JFC"}
+
+// LookupClasses returns the classes named by abbreviation or heading,
+// either built in classes or classes defined by defs.
+func LookupClasses(names []string, defs []ClassDef) ([]Class, error) {
+	all := Classes
+	for _, d := range defs {
+		c, err := d.Compile()
+		if err != nil {
+			return nil, err
+		}
+		for _, b := range all {
+			if c.Abbr == b.Abbr || c.Heading == b.Heading {
+				return nil, fmt.Errorf("class %s defined more than once", c.Abbr)
+			}
+		}
+		all = append(all[:len(all):len(all)], c)
+	}
+	cl := make([]Class, len(names))
+names:
+	for x, n := range names {
+		for _, c := range all {
+			if n == c.Abbr || n == c.Heading {
+				for _, p := range cl[:x] {
+					if p.Abbr == c.Abbr {
+						return nil, fmt.Errorf("orbit class %s repeated", n)
+					}
+				}
+				cl[x] = c
+				continue names
+			}
+		}
+		return nil, fmt.Errorf("unknown orbit class %q", n)
+	}
+	return cl, nil
+}
+
+// cListDefs are the definitions of defined classes of CList.
+var cListDefs []ClassDef
+
+// SetClasses sets CList to the classes named by abbreviation or heading,
+// as by LookupClasses.
+func SetClasses(names []string, defs []ClassDef) error {
+	cl, err := LookupClasses(names, defs)
+	if err != nil {
+		return err
+	}
+	CList = cl
+	cListDefs = nil
+	for _, c := range cl {
+		for _, d := range defs {
+			if d.Abbr == c.Abbr {
+				cListDefs = append(cListDefs, d)
+			}
+		}
+	}
+	return nil
+}
+
+// ClassDefs returns the definitions of the defined classes of CList, in
+// CList order.
+func ClassDefs() []ClassDef {
+	return cListDefs
+}
+
+// ClassAbbrs returns the abbreviations of CList.
+func ClassAbbrs() []string {
+	a := make([]string, len(CList))
+	for x, c := range CList {
+		a[x] = c.Abbr
+	}
+	return a
 }
 
 // 'MPC interesting' objects
 // The definition of MPC interesting implemented here is:
 // any of: q < 1.3, e > .5, i > 40, or Q > 10
-func isMpcint(q, e float64, i unit.Angle, h float64) bool {
-	return q < 1.3 || e >= .5 || i >= 40*math.Pi/180 || q*(1+e)/(1-e) > 10
+func isMpcint(o *Orbit) bool {
+	return o.Q < 1.3 || o.E >= .5 || o.I >= 40*math.Pi/180 ||
+		o.Q*(1+o.E)/(1-o.E) > 10
 }
 
 // 'NEO' objects
 // The definition of NEO implemented here is q < 1.3
-func isNeo(q, e float64, i unit.Angle, h float64) bool {
-	return q < 1.3
+func isNeo(o *Orbit) bool {
+	return o.Q < 1.3
 }
 
 // H18 NEOs
 // H rounded to nearest integer <= 18
-func isH18Neo(q, e float64, i unit.Angle, h float64) bool {
-	return q < 1.3 && h < 18.5
+func isH18Neo(o *Orbit) bool {
+	return o.Q < 1.3 && o.H < 18.5
 }
 
 // H22 NEOs
 // H rounded to nearest integer <= 22
-func isCMO(q, e float64, i unit.Angle, h float64) bool {
-	return q < 1.3 && h < 22.5
+func isCMO(o *Orbit) bool {
+	return o.Q < 1.3 && o.H < 22.5
+}
+
+// Potentially hazardous asteroids
+// Earth MOID < .05, H rounded to nearest integer <= 22
+func isPHA(o *Orbit) bool {
+	// quick rejects, orbits that do not come within .05 AU of the Earth's
+	// perihelion and aphelion distances
+	if o.H >= 22.5 || o.Q > earthA*(1+earthE)+.05 ||
+		o.E < 1 && o.Q*(1+o.E)/(1-o.E) < earthA*(1-earthE)-.05 {
+		return false
+	}
+	return o.moidBelow(.05)
+}
+
+// Atiras
+// Q < .983
+func isAtira(o *Orbit) bool {
+	return o.E < 1 && o.Q*(1+o.E)/(1-o.E) < .983
+}
+
+// Atens
+// a < 1, Q > .983
+func isAten(o *Orbit) bool {
+	return o.E < 1 && o.Q < (1-o.E) && o.Q*(1+o.E)/(1-o.E) > .983
+}
+
+// Apollos
+// a >= 1, q < 1.017
+func isApollo(o *Orbit) bool {
+	return o.Q < 1.017 && (o.E >= 1 || o.Q >= 1-o.E)
+}
+
+// Amors
+// 1.017 < q < 1.3
+func isAmor(o *Orbit) bool {
+	return o.Q > 1.017 && o.Q < 1.3
 }
 
 // Mars Crosser
 // 1.3 <= q < 1.67, Q > 1.58
-func isMarsCrosser(q, e float64, i unit.Angle, h float64) bool {
-	return q < 1.67 && q >= 1.3 && q*(1+e)/(1-e) > 1.58
+func isMarsCrosser(o *Orbit) bool {
+	return o.Q < 1.67 && o.Q >= 1.3 && o.Q*(1+o.E)/(1-o.E) > 1.58
 }
 
 // Hungarias
 // 1.78>a>2.0, e<.18, 16 < i < 28
 // (a node test would be nice...)
-func isHungaria(q, e float64, i unit.Angle, h float64) bool {
-	if e > .18 || i < 16*math.Pi/180 || i > 34*math.Pi/180 {
+func isHungaria(o *Orbit) bool {
+	if o.E > .18 || o.I < 16*math.Pi/180 || o.I > 34*math.Pi/180 {
 		return false
 	}
-	a := q / (1 - e)
+	a := o.Q / (1 - o.E)
 	return a < 2 && a > 1.78
 }
 
 // Phocaeas
 // q>1.5, 2.2<a<2.45, 20<i<27
-func isPhocaea(q, e float64, i unit.Angle, h float64) bool {
-	if q < 1.5 || i < 20*math.Pi/180 || i > 27*math.Pi/180 {
+func isPhocaea(o *Orbit) bool {
+	if o.Q < 1.5 || o.I < 20*math.Pi/180 || o.I > 27*math.Pi/180 {
 		return false
 	}
-	a := q / (1 - e)
+	a := o.Q / (1 - o.E)
 	return a < 2.45 && a > 2.2
 }
 
 // Inner Main Belt
 // q>1.67, 2.1<a<2.5, i<7 at inner edge, <17 at outer
-func isInnerMB(q, e float64, i unit.Angle, h float64) bool {
-	if q < 1.67 {
+func isInnerMB(o *Orbit) bool {
+	if o.Q < 1.67 {
 		return false
 	}
-	a := q / (1 - e)
-	return a < 2.5 && a > 2.1 && i < unit.AngleFromDeg(((a-2.1)/.4)*10+7)
+	a := o.Q / (1 - o.E)
+	return a < 2.5 && a > 2.1 && o.I < unit.AngleFromDeg(((a-2.1)/.4)*10+7)
 }
 
 // Hansas
 // 2.55<a<2.72 e<.25, 20<i<23.5
-func isHansa(q, e float64, i unit.Angle, h float64) bool {
-	if e > .25 || i < 20*math.Pi/180 || i > 23.5*math.Pi/180 {
+func isHansa(o *Orbit) bool {
+	if o.E > .25 || o.I < 20*math.Pi/180 || o.I > 23.5*math.Pi/180 {
 		return false
 	}
-	a := q / (1 - e)
+	a := o.Q / (1 - o.E)
 	return a < 2.72 && a > 2.55
 }
 
 // Pallas group
 // 2.5<a<2.8, e<.35, 24<i<37
-func isPallas(q, e float64, i unit.Angle, h float64) bool {
-	if e > .35 || i < 24*math.Pi/180 || i > 37*math.Pi/180 {
+func isPallas(o *Orbit) bool {
+	if o.E > .35 || o.I < 24*math.Pi/180 || o.I > 37*math.Pi/180 {
 		return false
 	}
-	a := q / (1 - e)
+	a := o.Q / (1 - o.E)
 	return a < 2.8 && a > 2.5
 }
 
 // Mid Main Belt
 // 2.5<a<2.8, e<.45, i<20
-func isMidMB(q, e float64, i unit.Angle, h float64) bool {
-	if e > .45 || i > 20*math.Pi/180 {
+func isMidMB(o *Orbit) bool {
+	if o.E > .45 || o.I > 20*math.Pi/180 {
 		return false
 	}
-	a := q / (1 - e)
+	a := o.Q / (1 - o.E)
 	return a < 2.8 && a > 2.5
 }
 
 // Outer Main Belt
 //  2.8<a<3.25 e<.4, i < 20 inner edge, i < 36 outer edge
-func isOuterMB(q, e float64, i unit.Angle, h float64) bool {
-	if e > .4 {
+func isOuterMB(o *Orbit) bool {
+	if o.E > .4 {
 		return false
 	}
-	a := q / (1 - e)
-	return a > 2.8 && a < 3.25 && i < unit.AngleFromDeg(((a-2.8)/.45)*16+20)
+	a := o.Q / (1 - o.E)
+	return a > 2.8 && a < 3.25 && o.I < unit.AngleFromDeg(((a-2.8)/.45)*16+20)
 }
 
 // Hildas
 // 3.9<a<4.02, e<.4, i<18
-func isHilda(q, e float64, i unit.Angle, h float64) bool {
-	if i > 18*math.Pi/180 || e > .4 {
+func isHilda(o *Orbit) bool {
+	if o.I > 18*math.Pi/180 || o.E > .4 {
 		return false
 	}
-	a := q / (1 - e)
+	a := o.Q / (1 - o.E)
 	return a > 3.9 && a < 4.02
 }
 
 // Trojans
 // 5.05<a<5.35, e<.22, i<38
-func isTrojan(q, e float64, i unit.Angle, h float64) bool {
-	if e > .22 || i > 38*math.Pi/180 {
+func isTrojan(o *Orbit) bool {
+	if o.E > .22 || o.I > 38*math.Pi/180 {
 		return false
 	}
-	a := q / (1 - e)
+	a := o.Q / (1 - o.E)
 	return a > 5.05 && a < 5.35
 }
 
 // Jupiter Family Comets
 // 2 < Tj < 3, q >= 1.67
-func isJFC(q, e float64, i unit.Angle, h float64) bool {
-	if q < 1.3 {
+func isJFC(o *Orbit) bool {
+	if o.Q < 1.3 {
 		return false
 	}
-	tj := 5.2*(1-e)/q + 2*math.Sqrt(q*(1+e)/5.2)*i.Cos()
+	tj := 5.2*(1-o.E)/o.Q + 2*math.Sqrt(o.Q*(1+o.E)/5.2)*o.I.Cos()
 	return tj < 3 && tj > 2
 }
+
+// Centaurs
+// q >= 5.2, a < 30.1, between the orbits of Jupiter and Neptune
+func isCentaur(o *Orbit) bool {
+	return o.Q >= 5.2 && o.E < 1 && o.Q/(1-o.E) < 30.1
+}
+
+// Classical and resonant trans-Neptunian objects
+// 30.1 <= a < 50, e < .35
+func isTNO(o *Orbit) bool {
+	if o.E >= .35 {
+		return false
+	}
+	a := o.Q / (1 - o.E)
+	return a >= 30.1 && a < 50
+}
+
+// Scattered disk objects
+// a >= 30.1, q >= 25, and not classical or resonant TNO
+func isSDO(o *Orbit) bool {
+	return o.Q >= 25 && o.E < 1 && o.Q/(1-o.E) >= 30.1 && !isTNO(o)
+}
+
+// Long Period Comets
+// e > .9 and period > 200 years, a > 34.2, or unbound
+func isLPC(o *Orbit) bool {
+	return o.E > .9 && (o.E >= 1 || o.Q/(1-o.E) > 34.2)
+}
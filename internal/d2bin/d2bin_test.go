@@ -3,7 +3,12 @@
 package d2bin_test
 
 import (
+	"bytes"
 	"fmt"
+	"math"
+	"math/rand"
+	"os"
+	"strings"
 	"testing"
 
 	"github.com/soniakeys/digest2/internal/d2bin"
@@ -14,14 +19,15 @@ func ExampleNew() {
 	d2bin.MSize = 3
 	fmt.Printf("%+v\n", d2bin.New())
 	// Output:
-	// &{SS:[0 0 0] Class:[[0 0 0] [0 0 0] [0 0 0] [0 0 0] [0 0 0] [0 0 0] [0 0 0] [0 0 0] [0 0 0] [0 0 0] [0 0 0] [0 0 0] [0 0 0] [0 0 0] [0 0 0]]}
+	// &{SS:[0 0 0] Class:[[0 0 0] [0 0 0] [0 0 0] [0 0 0] [0 0 0] [0 0 0] [0 0 0] [0 0 0] [0 0 0] [0 0 0] [0 0 0] [0 0 0] [0 0 0] [0 0 0] [0 0 0] [0 0 0] [0 0 0] [0 0 0] [0 0 0] [0 0 0] [0 0 0] [0 0 0] [0 0 0] [0 0 0]]}
 }
 
 func TestModel(t *testing.T) {
-	all, unk, _, _, err := d2bin.ReadFile("../digest2.gmodel")
+	m, err := d2bin.ReadFile("../digest2.gmodel")
 	if err != nil {
 		t.Skip(err)
 	}
+	all, unk := m.All, m.Unk[0]
 	// echo partitions
 	t.Log("QPart:", d2bin.QPart)
 	t.Log("EPart:", d2bin.EPart)
@@ -34,11 +40,9 @@ func TestModel(t *testing.T) {
 
 	// class list example
 	e, i, h := .1, unit.AngleFromDeg(20), 18.
-	q := 1.8 * (1 - e)
-	t.Logf("%-14s: %t\n",
-		d2bin.CList[5].Heading, d2bin.CList[5].IsClass(q, e, i, h))
-	t.Logf("%-14s: %t\n",
-		d2bin.CList[6].Heading, d2bin.CList[6].IsClass(q, e, i, h))
+	o := &d2bin.Orbit{Q: 1.8 * (1 - e), E: e, I: i, H: h}
+	t.Logf("%-14s: %t\n", d2bin.CList[5].Heading, d2bin.CList[5].IsClass(o))
+	t.Logf("%-14s: %t\n", d2bin.CList[6].Heading, d2bin.CList[6].IsClass(o))
 
 	// bin indexes
 	for _, h := range []float64{5.9, 6, 18, 25, 26} {
@@ -72,3 +76,420 @@ func TestModel(t *testing.T) {
 	// Modeled Hungarias in bin:  380.1315561749643
 	// Unknown Hungarias in bin:  143.10835055998658
 }
+
+func TestWriteRead(t *testing.T) {
+	d2bin.QPart = []float64{1, 2}
+	d2bin.EPart = []float64{.5}
+	d2bin.IPart = []unit.Angle{unit.AngleFromDeg(10)}
+	d2bin.HPart = []float64{15, 20}
+	d2bin.MSize = 4
+	all := d2bin.New()
+	all.SS[3] = 7
+	unk := []d2bin.Model{*d2bin.New(), *d2bin.New(), *d2bin.New()}
+	unk[1].Class[2][1] = 5
+	m := &d2bin.File{
+		Header: d2bin.Header{
+			Catalog: "MPCORB.DAT",
+			UnkSpecs: []d2bin.UnkSpec{
+				{Name: d2bin.UnkName(10), Arcsec: 10},
+				{Name: d2bin.UnkName(600), Arcsec: 600, Epoch: 50000},
+				{Name: d2bin.UnkName(600), Arcsec: 600, Epoch: 51000},
+			},
+		},
+		All: *all,
+		Unk: unk,
+	}
+	var buf bytes.Buffer
+	if err := m.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	d2bin.MSize = 0
+	r, err := d2bin.Read(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Version != d2bin.Version || r.Catalog != "MPCORB.DAT" ||
+		len(r.Classes) != len(d2bin.Classes) ||
+		d2bin.MSize != 4 || d2bin.LastH != 1 {
+		t.Fatalf("header %+v, MSize %d", r.Header, d2bin.MSize)
+	}
+	if r.All.SS[3] != 7 || len(r.Unk) != 3 || r.Unk[1].Class[2][1] != 5 {
+		t.Fatal("model content")
+	}
+	if x := r.UnkIndex(`10'`); x != 1 {
+		t.Fatal("UnkIndex", x)
+	}
+	g := r.UnkGroups()
+	if len(g) != 2 || len(g[1].Models) != 2 || g[1].Models[1] != 2 {
+		t.Fatalf("UnkGroups %+v", g)
+	}
+
+	// Decode leaves package variables alone
+	cur := d2bin.CurrentPartitions()
+	if err := m.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	d2bin.HPart = []float64{10, 15, 20}
+	_, p, err := d2bin.Decode(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(d2bin.HPart) != 3 || !p.Equal(cur) ||
+		p.Equal(d2bin.CurrentPartitions()) {
+		t.Fatalf("Decode partitions %+v", p)
+	}
+}
+
+func TestWeights(t *testing.T) {
+	g := d2bin.UnkGroup{Models: []int{0, 1, 2}, Epochs: []float64{10, 20, 40}}
+	for _, tc := range []struct {
+		mjd float64
+		w   []float64
+	}{
+		{5, []float64{1, 0, 0}},
+		{15, []float64{.5, .5, 0}},
+		{35, []float64{0, .25, .75}},
+		{50, []float64{0, 0, 1}},
+	} {
+		w := g.Weights(tc.mjd)
+		for x := range w {
+			if w[x] != tc.w[x] {
+				t.Fatal(tc.mjd, w)
+			}
+		}
+	}
+}
+
+func TestClasses(t *testing.T) {
+	defer d2bin.SetClasses(d2bin.ClassAbbrs(), nil)
+	if err := d2bin.SetClasses([]string{"NEO", "Long period cmt"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if a := d2bin.ClassAbbrs(); len(a) != 2 || a[1] != "LPC" {
+		t.Fatal(a)
+	}
+	for _, n := range [][]string{{"NEA"}, {"NEO", "NEO(q < 1.3)"}} {
+		if err := d2bin.SetClasses(n, nil); err == nil {
+			t.Fatal("accepted", n)
+		}
+	}
+	lpc := d2bin.CList[1].IsClass
+	for _, tc := range []struct {
+		q, e float64
+		lpc  bool
+	}{{1.5, .97, true}, {1, .97, false}, {4, .9, false}, {.5, 1.05, true}} {
+		if lpc(&d2bin.Orbit{Q: tc.q, E: tc.e, H: 10}) != tc.lpc {
+			t.Fatal(tc)
+		}
+	}
+}
+
+func TestNEOGroups(t *testing.T) {
+	cl, err := d2bin.LookupClasses([]string{"Ati", "Ate", "Apo", "Amo"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		q, e  float64
+		group int // index into cl, -1 for none
+	}{
+		{.5, .3, 0},   // a .71, Q .93
+		{.5, .4, 1},   // a .83, Q 1.17
+		{.9, .2, 2},   // a 1.125
+		{1.01, .5, 2}, // q < 1.017
+		{.5, 1.1, 2},  // unbound
+		{1.1, .3, 3},
+		{1.4, .3, -1},
+	} {
+		for x, c := range cl {
+			if c.IsClass(&d2bin.Orbit{Q: tc.q, E: tc.e, H: 20}) != (x == tc.group) {
+				t.Fatal(c.Abbr, tc)
+			}
+		}
+	}
+}
+
+func TestOuterClasses(t *testing.T) {
+	cl, err := d2bin.LookupClasses([]string{"Cen", "TNO", "SDO"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		a, e  float64
+		class int // index into cl, -1 for none
+	}{
+		{13.7, .38, 0}, // Chiron
+		{5.2, .05, -1}, // Jupiter Trojan
+		{39.5, .25, 1}, // Pluto
+		{44, .05, 1},   // classical
+		{67.7, .44, 2}, // Eris
+		{45, .4, 2},    // q 27
+		{45, .5, -1},   // q 22.5
+		{40, 1.05, -1}, // unbound, q 30
+		{1000, .97, 2}, // q 30
+	} {
+		q := tc.a * (1 - tc.e)
+		if tc.e > 1 {
+			q = 30
+		}
+		for x, c := range cl {
+			if c.IsClass(&d2bin.Orbit{Q: q, E: tc.e, H: 6}) != (x == tc.class) {
+				t.Fatal(c.Abbr, tc)
+			}
+		}
+	}
+}
+
+func TestMOID(t *testing.T) {
+	deg := unit.AngleFromDeg
+	earthPeri := deg(102.94719)
+	pha, err := d2bin.LookupClasses([]string{"PHA"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		name string
+		o    d2bin.Orbit
+		moid float64
+		tol  float64
+		pha  bool
+	}{
+		// a circle of radius 1 crosses the Earth orbit
+		{"circle", d2bin.Orbit{Q: 1, H: 20, Angles: true}, 0, 1e-6, true},
+		{"circle 1.2", d2bin.Orbit{Q: 1.2, H: 20, Angles: true},
+			.18329, 1e-5, false},
+		// polar circle with nodes at the Earth perihelion and aphelion
+		{"polar", d2bin.Orbit{Q: 1, I: deg(90), H: 20,
+			Node: earthPeri, Angles: true}, .01671, 1e-5, true},
+		{"polar faint", d2bin.Orbit{Q: 1, I: deg(90), H: 23,
+			Node: earthPeri, Angles: true}, .01671, 1e-5, false},
+		// hyperbola with perihelion toward the Earth aphelion
+		{"hyperbola", d2bin.Orbit{Q: 1.2, E: 1.5, H: 20,
+			Peri: earthPeri + deg(180), Angles: true}, .18329, 1e-5, false},
+		// (99942) Apophis, before the 2029 encounter
+		{"Apophis", d2bin.Orbit{Q: .9224 * (1 - .1911), E: .1911,
+			I: deg(3.339), H: 19.1, Node: deg(203.96), Peri: deg(126.60),
+			Angles: true}, .0003, .002, true},
+		// (1) Ceres
+		{"Ceres", d2bin.Orbit{Q: 2.7691 * (1 - .0785), E: .0785,
+			I: deg(10.59), H: 3.3, Node: deg(80.3), Peri: deg(73.6),
+			Angles: true}, 1.58, .01, false},
+	} {
+		o, m := tc.o, tc.o
+		if pha[0].IsClass(&o) != tc.pha {
+			t.Errorf("%s: PHA %t", tc.name, !tc.pha)
+		}
+		if m := m.MOID(); math.Abs(m-tc.moid) > tc.tol {
+			t.Errorf("%s: MOID %.6f, want %.6f", tc.name, m, tc.moid)
+		}
+	}
+	o := d2bin.Orbit{Q: 1, H: 20}
+	if !math.IsNaN(o.MOID()) || pha[0].IsClass(&o) {
+		t.Fatal("MOID without angles")
+	}
+	// PHA searches only near the Earth orbit.  it must agree with MOID.
+	r := rand.New(rand.NewSource(1))
+	for n := 0; n < 10000; n++ {
+		o := d2bin.Orbit{Q: .5 + r.Float64()*.6, E: r.Float64() * 1.1,
+			I: deg(r.Float64() * 180), H: 20, Node: deg(r.Float64() * 360),
+			Peri: deg(r.Float64() * 360), Angles: true}
+		m := o
+		if moid := m.MOID(); pha[0].IsClass(&o) != (moid < .05) &&
+			math.Abs(moid-.05) > 1e-6 {
+			t.Fatalf("%+v: PHA %t, MOID %g", o, !(moid < .05), moid)
+		}
+	}
+}
+
+// AnglesFunc is called only when a class needs the angles, and once.
+func TestAnglesFunc(t *testing.T) {
+	pha, err := d2bin.LookupClasses([]string{"PHA", "MB1"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var n int
+	f := func() (node, peri unit.Angle) {
+		n++
+		return 0, 0
+	}
+	// main belt orbit, rejected by PHA before the angles are needed
+	o := d2bin.Orbit{Q: 2.2, E: .1, I: unit.AngleFromDeg(5), H: 15,
+		AnglesFunc: f}
+	for _, c := range pha {
+		c.IsClass(&o)
+	}
+	if n != 0 {
+		t.Fatal("angles computed for main belt orbit")
+	}
+	// circle of radius 1 crosses the Earth orbit
+	o = d2bin.Orbit{Q: 1, H: 20, AnglesFunc: f}
+	if !pha[0].IsClass(&o) || o.MOID() > 1e-6 {
+		t.Fatal("PHA not found with AnglesFunc")
+	}
+	if n != 1 {
+		t.Fatal("angles computed", n, "times")
+	}
+}
+
+func ExampleUnkName() {
+	fmt.Println(d2bin.UnkName(10), d2bin.UnkName(60), d2bin.UnkName(90),
+		d2bin.UnkName(600))
+	// Output:
+	// 10" 1' 90" 10'
+}
+
+func ExampleParsePartitions() {
+	p, err := d2bin.ParsePartitions(strings.NewReader(`# finer near q = 1.3
+q .4 1 1.2 1.25 1.3 1.35 1.4 2 5.5 100
+e .1 .5 1.1
+i 5 20 180
+h 18 22 24 25.5 27
+`))
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	p.WriteText(os.Stdout)
+	_, err = d2bin.ParsePartitions(strings.NewReader("q 1 2\ne .5 .4\n"))
+	fmt.Println(err)
+	// Output:
+	// q 0.4 1 1.2 1.25 1.3 1.35 1.4 2 5.5 100
+	// e 0.1 0.5 1.1
+	// i 5 20 180
+	// h 18 22 24 25.5 27
+	// line 2: e limits must be positive and increasing
+}
+
+func TestS3M(t *testing.T) {
+	p, err := d2bin.ParsePartitions(strings.NewReader(
+		"q 1 2\ne .5\ni 10\nh 15 20\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.Set()
+	m := d2bin.New()
+	m.SS[3] = 1. / 3
+	m.Class[2][1] = 5
+	var bin, text bytes.Buffer
+	h := d2bin.S3MHeader{Sources: []string{"S0.s3m"}, Orbits: 9}
+	if err := d2bin.WriteS3M(&bin, h, m); err != nil {
+		t.Fatal(err)
+	}
+	if err := d2bin.WriteS3MText(&text, m); err != nil {
+		t.Fatal(err)
+	}
+	b := append([]byte{}, bin.Bytes()...)
+	d2bin.HPart = []float64{10, 15, 20}
+	for _, tc := range []struct {
+		r *bytes.Buffer
+		v int
+	}{{&bin, d2bin.S3MVersion}, {&text, 0}} {
+		rh, rm, rp, err := d2bin.ReadS3M(tc.r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if rh.Version != tc.v || len(rh.Classes) != len(d2bin.CList) ||
+			rh.Classes[23] != "LPC" ||
+			!rp.Equal(p) || rm.SS[3] != 1./3 || rm.Class[2][1] != 5 {
+			t.Fatalf("read %+v %+v", rh, rp)
+		}
+	}
+	if len(d2bin.HPart) != 3 {
+		t.Fatal("ReadS3M set partitions")
+	}
+
+	// corrupt files
+	b[len(b)/2] ^= 1
+	if _, _, _, err := d2bin.ReadS3M(bytes.NewReader(b)); err == nil {
+		t.Fatal("checksum not verified")
+	}
+	s := strings.Replace(text.String(), d2bin.CList[1].Heading, "NEA", 1)
+	if _, _, _, err := d2bin.ReadS3M(strings.NewReader(s)); err == nil {
+		t.Fatal("class heading not verified")
+	}
+}
+
+func TestClassDef(t *testing.T) {
+	defs, err := d2bin.ParseClassDefs(strings.NewReader(`# test classes
+NHi "NEO(i > 40)" q < 1.3 && i > 40
+JX  "Jupiter cross." q < 5.2 && Q > 5.2
+Tj2 "Tj < 2" !(Tj >= 2) || a - 2 * 3 > -1 / 4
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cl, err := d2bin.LookupClasses([]string{"NEO", "NHi", "JX", "Tj2"}, defs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		q, e, i float64
+		is      [4]bool
+	}{
+		{1, .2, 45, [4]bool{true, true, false, false}},
+		{1, .2, 10, [4]bool{true, false, false, false}},
+		{4, .5, 10, [4]bool{false, false, true, true}},
+		{2, .1, 10, [4]bool{false, false, false, false}},
+	} {
+		for x, c := range cl {
+			o := &d2bin.Orbit{Q: tc.q, E: tc.e, I: unit.AngleFromDeg(tc.i), H: 15}
+			if c.IsClass(o) != tc.is[x] {
+				t.Fatal(c.Abbr, tc)
+			}
+		}
+	}
+	for _, d := range []string{
+		`Long "x" q < 1`,
+		`X x q < 1`,
+		`X "x"`,
+		`X "x" q + 1`,
+		`X "x" q < 1 < 2`,
+		`X "x" q && e`,
+		`X "x" (q < 1`,
+		`X "x" z < 1`,
+	} {
+		if _, err := d2bin.ParseClassDef(d); err == nil {
+			t.Fatal("accepted", d)
+		}
+	}
+	if _, err := d2bin.LookupClasses(nil, []d2bin.ClassDef{
+		{"NEO", "Near Earth", "q < 1.3"}}); err == nil {
+		t.Fatal("redefined built in class")
+	}
+}
+
+func TestClassDefFiles(t *testing.T) {
+	defer d2bin.SetClasses(d2bin.ClassAbbrs(), d2bin.ClassDefs())
+	d := d2bin.ClassDef{"NHi", "NEO(i > 40)", "q < 1.3 && i > 40"}
+	if err := d2bin.SetClasses([]string{"NEO", "NHi"},
+		[]d2bin.ClassDef{d}); err != nil {
+		t.Fatal(err)
+	}
+	p, _ := d2bin.ParsePartitions(strings.NewReader("q 2\ne 1\ni 90\nh 20\n"))
+	p.Set()
+	m := d2bin.New()
+	m.Class[1][0] = 3
+	var text, bin, mf bytes.Buffer
+	d2bin.WriteS3MText(&text, m)
+	d2bin.WriteS3M(&bin, d2bin.S3MHeader{}, m)
+	f := &d2bin.File{All: *m}
+	f.Write(&mf)
+	d2bin.SetClasses([]string{"NEO"}, nil)
+	for _, r := range []*bytes.Buffer{&text, &bin} {
+		h, rm, _, err := d2bin.ReadS3M(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(h.ClassDefs) != 1 || h.ClassDefs[0] != d || rm.Class[1][0] != 3 {
+			t.Fatalf("%+v", h)
+		}
+	}
+	if _, err := d2bin.Read(&mf); err != nil {
+		t.Fatal(err)
+	}
+	if cd := d2bin.ClassDefs(); len(d2bin.CList) != 2 || len(cd) != 1 ||
+		cd[0] != d || !d2bin.CList[1].IsClass(&d2bin.Orbit{Q: 1, E: .1,
+		I: unit.AngleFromDeg(50), H: 20}) {
+		t.Fatal(d2bin.ClassAbbrs(), cd)
+	}
+}
@@ -0,0 +1,349 @@
+// Public domain.
+
+package d2bin
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// ClassDef defines an orbit class with an expression.
+//
+// Expr is a boolean expression over the variables
+//
+//	q     perihelion distance, AU
+//	e     eccentricity
+//	i     inclination, degrees
+//	H     absolute magnitude, also h
+//	a     semimajor axis, AU, q / (1 - e), negative for unbound orbits
+//	Q     aphelion distance, AU, a (1 + e), +Inf for unbound orbits
+//	Tj    Tisserand parameter with respect to Jupiter
+//	MOID  Earth minimum orbit intersection distance, AU, NaN if the
+//	      node and argument of perihelion are not known
+//
+// with numbers, arithmetic operators + - * /, comparisons < <= > >= == !=,
+// logical operators && || !, and parentheses.  Precedence is as in Go, and
+// as in Go, comparisons with NaN other than != are false.
+// An example is
+//
+//	q < 1.3 && i > 40
+type ClassDef struct {
+	Abbr, Heading, Expr string
+}
+
+// String formats d in the format parsed by ParseClassDef.
+func (d ClassDef) String() string {
+	return d.Abbr + ` "` + d.Heading + `" ` + d.Expr
+}
+
+// ParseClassDef parses a class definition in the format
+//
+//	<abbr> "<heading>" <expression>
+//
+// Abbr is one to three characters, not white space.  The heading is any
+// text other than a double quote.  The expression is compiled to check it.
+func ParseClassDef(s string) (ClassDef, error) {
+	var d ClassDef
+	f := strings.Fields(s)
+	if len(f) == 0 {
+		return d, errors.New("empty class definition")
+	}
+	d.Abbr = f[0]
+	if len(d.Abbr) > 3 {
+		return d, fmt.Errorf("abbreviation %s more than 3 characters", d.Abbr)
+	}
+	s = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(s), d.Abbr))
+	if !strings.HasPrefix(s, `"`) {
+		return d, errors.New(`heading in double quotes expected`)
+	}
+	end := strings.IndexByte(s[1:], '"')
+	if end < 0 {
+		return d, errors.New("heading missing closing quote")
+	}
+	d.Heading = s[1 : end+1]
+	d.Expr = strings.TrimSpace(s[end+2:])
+	switch {
+	case strings.TrimSpace(d.Heading) == "":
+		return d, errors.New("empty heading")
+	case d.Expr == "":
+		return d, errors.New("no expression")
+	}
+	_, err := d.Compile()
+	return d, err
+}
+
+// ParseClassDefs parses a class definition file, a class definition on each
+// line.  Blank lines and lines starting with # are ignored.
+func ParseClassDefs(r io.Reader) ([]ClassDef, error) {
+	var defs []ClassDef
+	sc := bufio.NewScanner(r)
+	for ln := 1; sc.Scan(); ln++ {
+		l := strings.TrimSpace(sc.Text())
+		if l == "" || l[0] == '#' {
+			continue
+		}
+		d, err := ParseClassDef(l)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", ln, err)
+		}
+		defs = append(defs, d)
+	}
+	return defs, sc.Err()
+}
+
+// Compile compiles the expression of d and returns the class.
+func (d ClassDef) Compile() (Class, error) {
+	p := &exprParser{s: d.Expr}
+	p.next()
+	n, err := p.or()
+	if err == nil && p.tok != "" {
+		err = fmt.Errorf("unexpected %q", p.tok)
+	}
+	if err == nil && n.b == nil {
+		err = errors.New("expression is not a condition")
+	}
+	if err != nil {
+		return Class{}, fmt.Errorf("class %s: %v", d.Abbr, err)
+	}
+	b := n.b
+	return Class{
+		Abbr:    d.Abbr,
+		Heading: d.Heading,
+		IsClass: b,
+	}, nil
+}
+
+var exprIdents = map[string]func(*Orbit) float64{
+	"q": func(o *Orbit) float64 { return o.Q },
+	"e": func(o *Orbit) float64 { return o.E },
+	"i": func(o *Orbit) float64 { return o.I.Deg() },
+	"H": func(o *Orbit) float64 { return o.H },
+	"h": func(o *Orbit) float64 { return o.H },
+	"a": func(o *Orbit) float64 { return o.Q / (1 - o.E) },
+	"Q": func(o *Orbit) float64 {
+		if o.E >= 1 {
+			return math.Inf(1)
+		}
+		return o.Q * (1 + o.E) / (1 - o.E)
+	},
+	"Tj": func(o *Orbit) float64 {
+		return 5.2*(1-o.E)/o.Q + 2*math.Sqrt(o.Q*(1+o.E)/5.2)*o.I.Cos()
+	},
+	"MOID": (*Orbit).MOID,
+}
+
+// exprNode is a compiled subexpression, either a number or a condition.
+type exprNode struct {
+	n func(*Orbit) float64
+	b func(*Orbit) bool
+}
+
+// exprParser is a recursive descent parser.  Tok is the current token,
+// "" at the end of the expression.
+type exprParser struct {
+	s   string
+	tok string
+}
+
+func (p *exprParser) next() {
+	p.s = strings.TrimLeft(p.s, " \t")
+	if p.s == "" {
+		p.tok = ""
+		return
+	}
+	n := 1
+	switch c := p.s[0]; {
+	case c >= '0' && c <= '9' || c == '.':
+		for n < len(p.s) && (p.s[n] >= '0' && p.s[n] <= '9' || p.s[n] == '.') {
+			n++
+		}
+	case c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z':
+		for n < len(p.s) && (p.s[n] >= 'a' && p.s[n] <= 'z' ||
+			p.s[n] >= 'A' && p.s[n] <= 'Z' || p.s[n] >= '0' && p.s[n] <= '9') {
+			n++
+		}
+	default:
+		for _, op := range []string{"<=", ">=", "==", "!=", "&&", "||"} {
+			if strings.HasPrefix(p.s, op) {
+				n = 2
+			}
+		}
+	}
+	p.tok, p.s = p.s[:n], p.s[n:]
+}
+
+func (p *exprParser) or() (exprNode, error) {
+	x, err := p.and()
+	for err == nil && p.tok == "||" {
+		p.next()
+		var y exprNode
+		if y, err = p.and(); err == nil {
+			if err = bothCond(x, y, "||"); err == nil {
+				a, b := x.b, y.b
+				x = exprNode{b: func(o *Orbit) bool { return a(o) || b(o) }}
+			}
+		}
+	}
+	return x, err
+}
+
+func (p *exprParser) and() (exprNode, error) {
+	x, err := p.not()
+	for err == nil && p.tok == "&&" {
+		p.next()
+		var y exprNode
+		if y, err = p.not(); err == nil {
+			if err = bothCond(x, y, "&&"); err == nil {
+				a, b := x.b, y.b
+				x = exprNode{b: func(o *Orbit) bool { return a(o) && b(o) }}
+			}
+		}
+	}
+	return x, err
+}
+
+func bothCond(x, y exprNode, op string) error {
+	if x.b == nil || y.b == nil {
+		return fmt.Errorf("%s requires conditions", op)
+	}
+	return nil
+}
+
+func (p *exprParser) not() (exprNode, error) {
+	if p.tok != "!" {
+		return p.cmp()
+	}
+	p.next()
+	x, err := p.not()
+	if err == nil && x.b == nil {
+		err = errors.New("! requires a condition")
+	}
+	a := x.b
+	return exprNode{b: func(o *Orbit) bool { return !a(o) }}, err
+}
+
+func (p *exprParser) cmp() (exprNode, error) {
+	x, err := p.sum()
+	if err != nil {
+		return x, err
+	}
+	var f func(a, b float64) bool
+	switch op := p.tok; op {
+	case "<":
+		f = func(a, b float64) bool { return a < b }
+	case "<=":
+		f = func(a, b float64) bool { return a <= b }
+	case ">":
+		f = func(a, b float64) bool { return a > b }
+	case ">=":
+		f = func(a, b float64) bool { return a >= b }
+	case "==":
+		f = func(a, b float64) bool { return a == b }
+	case "!=":
+		f = func(a, b float64) bool { return a != b }
+	default:
+		return x, nil
+	}
+	op := p.tok
+	p.next()
+	y, err := p.sum()
+	if err != nil {
+		return y, err
+	}
+	if x.n == nil || y.n == nil {
+		return x, fmt.Errorf("%s requires numbers", op)
+	}
+	a, b := x.n, y.n
+	return exprNode{b: func(o *Orbit) bool { return f(a(o), b(o)) }}, nil
+}
+
+func (p *exprParser) sum() (exprNode, error) {
+	x, err := p.term()
+	for err == nil && (p.tok == "+" || p.tok == "-") {
+		op := p.tok
+		p.next()
+		var y exprNode
+		if y, err = p.term(); err == nil {
+			x, err = arith(x, y, op)
+		}
+	}
+	return x, err
+}
+
+func (p *exprParser) term() (exprNode, error) {
+	x, err := p.unary()
+	for err == nil && (p.tok == "*" || p.tok == "/") {
+		op := p.tok
+		p.next()
+		var y exprNode
+		if y, err = p.unary(); err == nil {
+			x, err = arith(x, y, op)
+		}
+	}
+	return x, err
+}
+
+func arith(x, y exprNode, op string) (exprNode, error) {
+	if x.n == nil || y.n == nil {
+		return x, fmt.Errorf("%s requires numbers", op)
+	}
+	a, b := x.n, y.n
+	var f func(*Orbit) float64
+	switch op {
+	case "+":
+		f = func(o *Orbit) float64 { return a(o) + b(o) }
+	case "-":
+		f = func(o *Orbit) float64 { return a(o) - b(o) }
+	case "*":
+		f = func(o *Orbit) float64 { return a(o) * b(o) }
+	default:
+		f = func(o *Orbit) float64 { return a(o) / b(o) }
+	}
+	return exprNode{n: f}, nil
+}
+
+func (p *exprParser) unary() (exprNode, error) {
+	if p.tok != "-" {
+		return p.primary()
+	}
+	p.next()
+	x, err := p.unary()
+	if err == nil && x.n == nil {
+		err = errors.New("- requires a number")
+	}
+	a := x.n
+	return exprNode{n: func(o *Orbit) float64 { return -a(o) }}, err
+}
+
+func (p *exprParser) primary() (exprNode, error) {
+	t := p.tok
+	switch {
+	case t == "":
+		return exprNode{}, errors.New("unexpected end of expression")
+	case t == "(":
+		p.next()
+		x, err := p.or()
+		if err == nil && p.tok != ")" {
+			err = errors.New(") expected")
+		}
+		p.next()
+		return x, err
+	case t[0] >= '0' && t[0] <= '9' || t[0] == '.':
+		c, err := strconv.ParseFloat(t, 64)
+		if err != nil {
+			return exprNode{}, fmt.Errorf("invalid number %s", t)
+		}
+		p.next()
+		return exprNode{n: func(*Orbit) float64 { return c }}, nil
+	}
+	if f, ok := exprIdents[t]; ok {
+		p.next()
+		return exprNode{n: f}, nil
+	}
+	return exprNode{}, fmt.Errorf("unexpected %q", t)
+}
@@ -0,0 +1,289 @@
+// Public domain.
+
+package d2bin
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Magic identifies a versioned model file.  Model files written before
+// versioning start directly with a gob stream and have no magic string.
+const Magic = "digest2.gmodel\n"
+
+// Version is the model file format version written by File.Write.
+// Version 1 is the unversioned format.  Version 3 adds Classes and
+// ClassDefs.
+const Version = 3
+
+// UnkSpec describes an unknown population model.
+//
+// The unknown population is the modeled population less known orbits that
+// are readily identifiable, meaning their ephemeris uncertainty is not
+// more than Arcsec arc seconds.
+//
+// If Epoch is not zero, the model uses ephemeris uncertainty estimated at
+// Epoch, an MJD.  Models with the same Name form a group that differ only
+// in Epoch.  They are stored consecutively, in order of increasing Epoch.
+type UnkSpec struct {
+	Name   string
+	Arcsec float64
+	Epoch  float64
+}
+
+// Header holds information about how a model was built.
+type Header struct {
+	Version       int
+	Catalog       string    // orbit catalog format
+	CatalogDate   time.Time // catalog file modification time
+	CatalogOrbits int       // number of orbits in the catalog
+	Uncertainty   string    // catalog uncertainty field used
+	// AsOf, if not zero, is a cutoff date.  Orbits first observed after
+	// AsOf are excluded from the known population.
+	AsOf     time.Time
+	UnkSpecs []UnkSpec // one for each unknown model
+	// Classes are the abbreviations of the orbit classes of the models.
+	// Version 1 and 2 files have the 15 classes of those versions.
+	Classes   []string
+	ClassDefs []ClassDef // definitions of classes that are not built in
+}
+
+// File is the content of a model file.
+//
+// Unk holds a model for each element of UnkSpecs, in the same order.
+type File struct {
+	Header
+	All Model
+	Unk []Model
+}
+
+// UnkName returns a name for an unknown model with identification threshold
+// arcsec.  Whole numbers of arc minutes are given in minutes, as in 1',
+// others in seconds, as in 10".
+func UnkName(arcsec float64) string {
+	if arcsec >= 60 && arcsec == 60*float64(int(arcsec/60)) {
+		return strconv.FormatFloat(arcsec/60, 'g', -1, 64) + "'"
+	}
+	return strconv.FormatFloat(arcsec, 'g', -1, 64) + `"`
+}
+
+// UnkGroup is a group of unknown models with the same name.
+type UnkGroup struct {
+	Name   string
+	Models []int     // indexes into UnkSpecs and File.Unk
+	Epochs []float64 // epochs of Models, a single 0 if not epoch specific
+}
+
+// UnkGroups returns the unknown models grouped by name.
+func (h *Header) UnkGroups() (g []UnkGroup) {
+	for x, u := range h.UnkSpecs {
+		if len(g) == 0 || g[len(g)-1].Name != u.Name {
+			g = append(g, UnkGroup{Name: u.Name})
+		}
+		l := &g[len(g)-1]
+		l.Models = append(l.Models, x)
+		l.Epochs = append(l.Epochs, u.Epoch)
+	}
+	return
+}
+
+// UnkIndex returns the index of the unknown model group with name n,
+// or -1 if there is none.
+func (h *Header) UnkIndex(n string) int {
+	for x, g := range h.UnkGroups() {
+		if g.Name == n {
+			return x
+		}
+	}
+	return -1
+}
+
+// Weights returns interpolation weights for the models of a group for
+// a date mjd.  Between epochs, the two bracketing models are weighted
+// linearly.  Before the first epoch or after the last, the nearest model
+// is used.  The returned slice parallels g.Models.
+func (g *UnkGroup) Weights(mjd float64) []float64 {
+	w := make([]float64, len(g.Models))
+	e := g.Epochs
+	switch n := len(e); {
+	case mjd <= e[0]:
+		w[0] = 1
+	case mjd >= e[n-1]:
+		w[n-1] = 1
+	default:
+		x := 1
+		for e[x] < mjd {
+			x++
+		}
+		f := (mjd - e[x-1]) / (e[x] - e[x-1])
+		w[x-1] = 1 - f
+		w[x] = f
+	}
+	return w
+}
+
+// ReadFile reads a population model.
+//
+// Argument fn is the filename of the model file created by muk.
+//
+// Package variables QPart, EPart, IPart, HPart, MSize, LastH, and CList
+// are set.
+func ReadFile(fn string) (*File, error) {
+	f, err := os.Open(fn)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	m, err := Read(f)
+	if err != nil {
+		err = fmt.Errorf("%s: %v", fn, err)
+	}
+	return m, err
+}
+
+// Read reads a population model from r.
+//
+// Both the versioned format and the older unversioned format are read.
+// See ReadFile.
+func Read(r io.Reader) (*File, error) {
+	m, p, err := Decode(r)
+	if err != nil {
+		return nil, err
+	}
+	p.Set()
+	SetClasses(m.Classes, m.ClassDefs)
+	return m, nil
+}
+
+// Decode reads a population model from r as Read does, but returns the
+// partitions rather than setting the package variables.  Classes are in
+// the header.
+func Decode(r io.Reader) (*File, *Partitions, error) {
+	br := bufio.NewReader(r)
+	if b, _ := br.Peek(len(Magic)); !bytes.Equal(b, []byte(Magic)) {
+		return readV1(gob.NewDecoder(br))
+	}
+	br.Discard(len(Magic))
+	dec := gob.NewDecoder(br)
+	var m File
+	if err := dec.Decode(&m.Header); err != nil {
+		return nil, nil, err
+	}
+	if m.Version > Version {
+		return nil, nil, fmt.Errorf("model format version %d not supported",
+			m.Version)
+	}
+	p, err := decodePartitions(dec)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := dec.Decode(&m.All); err != nil {
+		return nil, nil, err
+	}
+	if err := dec.Decode(&m.Unk); err != nil {
+		return nil, nil, err
+	}
+	if len(m.Unk) != len(m.UnkSpecs) {
+		return nil, nil, errors.New("unknown model count mismatch")
+	}
+	if m.Version < 3 {
+		m.Classes = v2Classes
+	}
+	if err := m.checkClasses(); err != nil {
+		return nil, nil, err
+	}
+	return &m, p, nil
+}
+
+// checkClasses checks that the classes of m are defined and match the
+// models.
+func (m *File) checkClasses() error {
+	if _, err := LookupClasses(m.Classes, m.ClassDefs); err != nil {
+		return err
+	}
+	for _, mc := range append([]Model{m.All}, m.Unk...) {
+		if len(mc.Class) != len(m.Classes) {
+			return errors.New("class count mismatch")
+		}
+	}
+	return nil
+}
+
+// readV1 reads the unversioned format, which has a single unknown model
+// built from astorb.dat with a 1' criterion.
+func readV1(dec *gob.Decoder) (*File, *Partitions, error) {
+	m := &File{Header: Header{
+		Version:     1,
+		Catalog:     "astorb.dat",
+		Uncertainty: "gpeu",
+		UnkSpecs:    []UnkSpec{{Name: UnkName(60), Arcsec: 60}},
+		Classes:     v2Classes,
+	}}
+	if err := dec.Decode(&m.CatalogDate); err != nil {
+		return nil, nil, err
+	}
+	if err := dec.Decode(&m.CatalogOrbits); err != nil {
+		return nil, nil, err
+	}
+	p, err := decodePartitions(dec)
+	if err != nil {
+		return nil, nil, err
+	}
+	var mSize, lastH int
+	dec.Decode(&mSize)
+	dec.Decode(&lastH)
+	m.Unk = make([]Model, 1)
+	dec.Decode(&m.All)
+	if err := dec.Decode(&m.Unk[0]); err != nil {
+		return nil, nil, err
+	}
+	if err := m.checkClasses(); err != nil {
+		return nil, nil, err
+	}
+	return m, p, nil
+}
+
+// decodePartitions decodes partitions.
+func decodePartitions(dec *gob.Decoder) (*Partitions, error) {
+	var p Partitions
+	if err := dec.Decode(&p.Q); err != nil {
+		return nil, err
+	}
+	dec.Decode(&p.E)
+	dec.Decode(&p.I)
+	if err := dec.Decode(&p.H); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// Write writes m in the versioned format, using the partitions and classes
+// of the package variables.
+func (m *File) Write(w io.Writer) error {
+	if len(m.Unk) != len(m.UnkSpecs) {
+		return errors.New("unknown model count mismatch")
+	}
+	if _, err := io.WriteString(w, Magic); err != nil {
+		return err
+	}
+	h := m.Header
+	h.Version = Version
+	h.Classes = ClassAbbrs()
+	h.ClassDefs = ClassDefs()
+	enc := gob.NewEncoder(w)
+	for _, v := range []interface{}{
+		&h, QPart, EPart, IPart, HPart, &m.All, m.Unk,
+	} {
+		if err := enc.Encode(v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,205 @@
+// Public domain.
+
+package d2bin
+
+import (
+	"math"
+
+	"github.com/soniakeys/unit"
+)
+
+// Orbit holds the elements of an orbit tested by Class.IsClass.
+//
+// Q is perihelion distance in AU, as with QPart.  Node and Peri are the
+// longitude of the ascending node and argument of perihelion, referred to
+// the J2000 ecliptic.  They are known only if Angles is true, or if
+// AnglesFunc is not nil, in which case it is called to compute them when
+// first needed.
+type Orbit struct {
+	Q, E       float64
+	I          unit.Angle
+	H          float64
+	Node, Peri unit.Angle
+	Angles     bool
+	AnglesFunc func() (node, peri unit.Angle)
+
+	moid     float64 // cached by MOID
+	moidDone bool
+}
+
+// Orbit of the Earth, J2000 ecliptic.  earthPeri is the longitude of
+// perihelion.
+const (
+	earthA    = 1.00000011
+	earthE    = .01671022
+	earthPeri = 102.94719 * math.Pi / 180
+)
+
+// MOID returns the minimum orbit intersection distance of o with the orbit
+// of the Earth, in AU.  It returns NaN if the angles of o are not known.
+//
+// The distance is sampled over true anomaly and each local minimum is
+// refined.  The result is cached in o.
+func (o *Orbit) MOID() float64 {
+	if !o.moidDone {
+		o.moid = math.NaN()
+		if o.angles() {
+			o.moid = earthMOID(o)
+		}
+		o.moidDone = true
+	}
+	return o.moid
+}
+
+// angles reports whether Node and Peri are known, computing them with
+// AnglesFunc if they are not yet.
+func (o *Orbit) angles() bool {
+	if !o.Angles && o.AnglesFunc != nil {
+		o.Node, o.Peri = o.AnglesFunc()
+		o.Angles = true
+	}
+	return o.Angles
+}
+
+// moidGrid is the number of true anomalies sampled by earthMOID before
+// refining minima.
+const moidGrid = 120
+
+// earthMOID computes the Earth MOID of o by sampling the whole orbit.
+func earthMOID(o *Orbit) float64 {
+	dist := earthDist(o)
+	if o.E < 1 {
+		return minDist(dist, -math.Pi, math.Pi, moidGrid, true, 0, 0)
+	}
+	// the range of true anomaly is open at the asymptotes.  keep clear of
+	// them by half a grid step.
+	lim := math.Acos(-1 / o.E)
+	h := lim / moidGrid
+	return minDist(dist, h-lim, lim-h, moidGrid, false, 0, 0)
+}
+
+// moidBelow reports whether the Earth MOID of o is less than limit, a small
+// distance.  It is faster than MOID as it searches only the arcs of the
+// orbit within limit of the range of the Earth's distance from the Sun.
+func (o *Orbit) moidBelow(limit float64) bool {
+	if o.moidDone || o.E < 1e-6 {
+		return o.MOID() < limit // false if MOID is NaN
+	}
+	if !o.angles() {
+		return false
+	}
+	// true anomalies of the arc where r is from r1 to r2, from
+	// cos(nu) = (p/r - 1) / e
+	r1 := earthA*(1-earthE) - limit
+	r2 := earthA*(1+earthE) + limit
+	p := o.Q * (1 + o.E)
+	c1, c2 := (p/r1-1)/o.E, (p/r2-1)/o.E
+	if c1 < -1 || c2 > 1 {
+		return false // the orbit is entirely inside or outside
+	}
+	nu1, nu2 := math.Acos(math.Min(c1, 1)), math.Acos(math.Max(c2, -1))
+	// sample about every 3 degrees.  at the ends of the arcs the distance
+	// is at least limit so minima there don't count.
+	n := int((nu2-nu1)/.05) + 4
+	// bound on the rate of change of distance with true anomaly, the speed
+	// of the point on the orbit with r at most r2, with a margin for the
+	// change of the Earth's distance with longitude
+	slope := 1.1 * r2 * math.Sqrt(1+r2*r2*o.E*o.E/(p*p))
+	dist := earthDist(o)
+	return minDist(dist, nu1, nu2, n, false, limit, slope) < limit ||
+		minDist(dist, -nu2, -nu1, n, false, limit, slope) < limit
+}
+
+// earthDist returns a function giving the distance from the point of the
+// orbit of o at true anomaly nu to the orbit of the Earth.
+//
+// The distance is taken as the distance to the point of the Earth orbit at
+// the same ecliptic longitude, which differs from the true distance only by
+// terms in the square of the eccentricity of the Earth orbit.
+func earthDist(o *Orbit) func(nu float64) float64 {
+	sn, cn := o.Node.Sincos()
+	sw, cw := o.Peri.Sincos()
+	si, ci := o.I.Sincos()
+	// unit vectors toward perihelion and 90 degrees ahead in the orbit plane
+	px, py, pz := cw*cn-sw*sn*ci, cw*sn+sw*cn*ci, sw*si
+	qx, qy, qz := -sw*cn-cw*sn*ci, -sw*sn+cw*cn*ci, cw*si
+	p := o.Q * (1 + o.E)
+	pE := earthA * (1 - earthE*earthE)
+	sE, cE := math.Sincos(earthPeri)
+	return func(nu float64) float64 {
+		s, c := math.Sincos(nu)
+		r := p / (1 + o.E*c)
+		x := r * (c*px + s*qx)
+		y := r * (c*py + s*qy)
+		z := r * (c*pz + s*qz)
+		rho := math.Hypot(x, y)
+		rE := earthA
+		if rho > 0 {
+			rE = pE / (1 + earthE*(x*cE+y*sE)/rho)
+		}
+		return math.Hypot(rho-rE, z)
+	}
+}
+
+// minDist returns the minimum of dist over true anomalies lo to hi.  It
+// samples n points and refines each local minimum by golden section search.
+// Wrap indicates lo to hi is the full circle.
+//
+// If stop is positive, a sample less than stop is returned without
+// refinement, and with slope bounding the rate of change of dist, minima
+// that cannot be less than stop are not refined.
+func minDist(dist func(float64) float64, lo, hi float64, n int, wrap bool,
+	stop, slope float64) float64 {
+	step := (hi - lo) / float64(n)
+	var buf [moidGrid]float64 // n is at most moidGrid
+	d := buf[:n]
+	for k := range d {
+		if d[k] = dist(lo + (float64(k)+.5)*step); d[k] < stop {
+			return d[k]
+		}
+	}
+	min := math.Inf(1)
+	for k, dk := range d {
+		prev, next := k-1, k+1
+		if wrap {
+			prev = (prev + n) % n
+			next %= n
+		}
+		if prev >= 0 && d[prev] < dk || next < n && d[next] < dk ||
+			stop > 0 && dk-slope*step >= stop {
+			if dk < min {
+				min = dk
+			}
+			continue
+		}
+		nu := lo + (float64(k)+.5)*step
+		a, b := nu-step, nu+step
+		if !wrap {
+			a, b = math.Max(a, lo), math.Min(b, hi)
+		}
+		if m := goldenMin(dist, a, b); m < min {
+			min = m
+		}
+	}
+	return min
+}
+
+// goldenMin returns the minimum of f in the interval a, b, by golden section
+// search.
+func goldenMin(f func(float64) float64, a, b float64) float64 {
+	const g = .6180339887498949 // 1/phi
+	c, d := b-g*(b-a), a+g*(b-a)
+	fc, fd := f(c), f(d)
+	for b-a > 1e-8 {
+		if fc < fd {
+			b, d, fd = d, c, fc
+			c = b - g*(b-a)
+			fc = f(c)
+		} else {
+			a, c, fc = c, d, fd
+			d = a + g*(b-a)
+			fd = f(d)
+		}
+	}
+	return math.Min(fc, fd)
+}
@@ -0,0 +1,168 @@
+// Public domain.
+
+package d2bin
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/soniakeys/unit"
+)
+
+// Partitions holds the partitions that define the shape of a model.
+//
+// Each partition is a list of upper bin limits in increasing order.  The
+// lower limit of the first bin is 0.  Values at or above the last limit are
+// outside the model, except for H, where the last bin is open ended.
+type Partitions struct {
+	Q, E []float64
+	I    []unit.Angle
+	H    []float64
+}
+
+// CurrentPartitions returns the partitions of the package variables.
+func CurrentPartitions() *Partitions {
+	return &Partitions{QPart, EPart, IPart, HPart}
+}
+
+// Set sets the package variables QPart, EPart, IPart, HPart, MSize, and
+// LastH from p.
+func (p *Partitions) Set() {
+	QPart, EPart, IPart, HPart = p.Q, p.E, p.I, p.H
+	LastH = len(HPart) - 1
+	MSize = p.size()
+}
+
+// size returns the number of bins in a model with partitions p.
+func (p *Partitions) size() int {
+	return len(p.Q) * len(p.E) * len(p.I) * len(p.H)
+}
+
+// check checks that each partition has limits, positive and increasing.
+func (p *Partitions) check() error {
+	i := make([]float64, len(p.I))
+	for x, a := range p.I {
+		i[x] = float64(a)
+	}
+	for _, l := range []struct {
+		e   string
+		lim []float64
+	}{{"q", p.Q}, {"e", p.E}, {"i", i}, {"h", p.H}} {
+		if len(l.lim) == 0 {
+			return errors.New("no partition for " + l.e)
+		}
+		for x, v := range l.lim {
+			if v <= 0 || x > 0 && v <= l.lim[x-1] {
+				return fmt.Errorf("%s limits must be positive and increasing",
+					l.e)
+			}
+		}
+	}
+	return nil
+}
+
+// Equal returns true if p and q have the same partitions.
+func (p *Partitions) Equal(q *Partitions) bool {
+	eq := func(a, b []float64) bool {
+		if len(a) != len(b) {
+			return false
+		}
+		for x, v := range a {
+			if b[x] != v {
+				return false
+			}
+		}
+		return true
+	}
+	if len(p.I) != len(q.I) {
+		return false
+	}
+	for x, v := range p.I {
+		if q.I[x] != v {
+			return false
+		}
+	}
+	return eq(p.Q, q.Q) && eq(p.E, q.E) && eq(p.H, q.H)
+}
+
+// ParsePartitions parses partitions in the text format written by
+// WriteText, a line for each of q, e, i, and h, giving the element followed
+// by the bin limits.  Inclinations are in degrees.
+//
+// Blank lines and lines starting with # are ignored.  Any other line, or
+// limits that are not positive and increasing, are an error.
+func ParsePartitions(r io.Reader) (*Partitions, error) {
+	p := &Partitions{}
+	var i []float64
+	parts := map[string]*[]float64{"q": &p.Q, "e": &p.E, "i": &i, "h": &p.H}
+	sc := bufio.NewScanner(r)
+	for ln := 1; sc.Scan(); ln++ {
+		f := strings.Fields(sc.Text())
+		if len(f) == 0 || strings.HasPrefix(f[0], "#") {
+			continue
+		}
+		pp, ok := parts[f[0]]
+		switch {
+		case !ok:
+			return nil, fmt.Errorf("line %d: unknown element %q", ln, f[0])
+		case *pp != nil:
+			return nil, fmt.Errorf("line %d: element %s repeated", ln, f[0])
+		case len(f) == 1:
+			return nil, fmt.Errorf("line %d: no limits for %s", ln, f[0])
+		}
+		lim := make([]float64, len(f)-1)
+		for x, s := range f[1:] {
+			v, err := strconv.ParseFloat(s, 64)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %v", ln, err)
+			}
+			if v <= 0 || x > 0 && v <= lim[x-1] {
+				return nil, fmt.Errorf(
+					"line %d: %s limits must be positive and increasing",
+					ln, f[0])
+			}
+			lim[x] = v
+		}
+		*pp = lim
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	for _, e := range []string{"q", "e", "i", "h"} {
+		if *parts[e] == nil {
+			return nil, errors.New("no partition for " + e)
+		}
+	}
+	p.I = make([]unit.Angle, len(i))
+	for x, d := range i {
+		p.I[x] = unit.AngleFromDeg(d)
+	}
+	return p, nil
+}
+
+// WriteText writes p in the format read by ParsePartitions.
+func (p *Partitions) WriteText(w io.Writer) error {
+	i := make([]float64, len(p.I))
+	for x, a := range p.I {
+		// round off conversion error so degrees print as given
+		i[x] = math.Round(a.Deg()*1e9) / 1e9
+	}
+	for _, l := range []struct {
+		e   string
+		lim []float64
+	}{{"q", p.Q}, {"e", p.E}, {"i", i}, {"h", p.H}} {
+		s := l.e
+		for _, v := range l.lim {
+			s += " " + strconv.FormatFloat(v, 'g', -1, 64)
+		}
+		if _, err := io.WriteString(w, s+"\n"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,270 @@
+// Public domain.
+
+package d2bin
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Sbfn, the binned model in binary format
+const Sbfn = "s3m.bin"
+
+// S3MMagic identifies a binned synthetic model in binary format.
+const S3MMagic = "digest2.s3m\n"
+
+// S3MVersion is the binary format version written by WriteS3M.
+const S3MVersion = 1
+
+// s3mText is the first line of the text format.
+const s3mText = "S3M binned"
+
+// S3MHeader holds information about how a binned synthetic model was built.
+type S3MHeader struct {
+	Version   int
+	Sources   []string   // population files binned
+	Orbits    int        // number of orbits read
+	Classes   []string   // abbreviations of the classes binned
+	ClassDefs []ClassDef // definitions of classes that are not built in
+}
+
+// WriteS3M writes synthetic model m in binary format, using the partitions
+// and classes of the package variables.
+//
+// The format is S3MMagic, a gob stream of the header, partitions, and m,
+// and a SHA-256 checksum of the gob stream.
+func WriteS3M(w io.Writer, h S3MHeader, m *Model) error {
+	h.Version = S3MVersion
+	h.Classes = ClassAbbrs()
+	h.ClassDefs = ClassDefs()
+	var buf bytes.Buffer
+	enc := gob.NewEncoder(&buf)
+	for _, v := range []interface{}{&h, QPart, EPart, IPart, HPart, m} {
+		if err := enc.Encode(v); err != nil {
+			return err
+		}
+	}
+	sum := sha256.Sum256(buf.Bytes())
+	if _, err := io.WriteString(w, S3MMagic); err != nil {
+		return err
+	}
+	if _, err := buf.WriteTo(w); err != nil {
+		return err
+	}
+	_, err := w.Write(sum[:])
+	return err
+}
+
+// WriteS3MText writes synthetic model m in the text format, using the
+// partitions and classes of the package variables.
+//
+// The text format is a line "S3M binned", the partitions as written by
+// Partitions.WriteText, the bins of m.SS, and then for each class, the
+// class heading and the bins of the class.  Bins are written a line for each
+// combination of q, e, and i, with a value for each H bin.  For a class
+// that is not built in, the class definition is written in place of the
+// heading.
+func WriteS3MText(w io.Writer, m *Model) error {
+	bw := bufio.NewWriter(w)
+	bw.WriteString(s3mText + "\n")
+	CurrentPartitions().WriteText(bw)
+	writeBins := func(bins []float64) {
+		for i := 0; i < len(bins); {
+			for range HPart {
+				fmt.Fprintf(bw, "%g ", bins[i])
+				i++
+			}
+			bw.WriteString("\n")
+		}
+	}
+	writeBins(m.SS)
+	defs := ClassDefs()
+	for cx, class := range m.Class {
+		h := CList[cx].Heading
+		for _, d := range defs {
+			if d.Abbr == CList[cx].Abbr {
+				h = d.String()
+			}
+		}
+		fmt.Fprintf(bw, "%s\n", h)
+		writeBins(class)
+	}
+	return bw.Flush()
+}
+
+// ReadS3MFile reads a binned synthetic model in either binary or text
+// format.  See ReadS3M.
+func ReadS3MFile(fn string) (*S3MHeader, *Model, *Partitions, error) {
+	f, err := os.Open(fn)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	defer f.Close()
+	h, m, p, err := ReadS3M(f)
+	if err != nil {
+		err = fmt.Errorf("%s: %v", fn, err)
+	}
+	return h, m, p, err
+}
+
+// ReadS3M reads a binned synthetic model from r in either the binary format
+// written by WriteS3M or the text format written by WriteS3MText.  The
+// partitions are returned and the classes are in the header, rather than
+// set in the package variables.
+//
+// Partitions are validated as by ParsePartitions and classes must be
+// defined in Classes.  For the text format, the returned header has
+// Version 0 and only Classes set.
+func ReadS3M(r io.Reader) (*S3MHeader, *Model, *Partitions, error) {
+	br := bufio.NewReader(r)
+	if b, _ := br.Peek(len(S3MMagic)); !bytes.Equal(b, []byte(S3MMagic)) {
+		return readS3MText(br)
+	}
+	br.Discard(len(S3MMagic))
+	b, err := ioutil.ReadAll(br)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if len(b) < sha256.Size {
+		return nil, nil, nil, errors.New("truncated")
+	}
+	b, sum := b[:len(b)-sha256.Size], b[len(b)-sha256.Size:]
+	if s := sha256.Sum256(b); !bytes.Equal(s[:], sum) {
+		return nil, nil, nil, errors.New("checksum mismatch")
+	}
+	dec := gob.NewDecoder(bytes.NewReader(b))
+	var h S3MHeader
+	if err := dec.Decode(&h); err != nil {
+		return nil, nil, nil, err
+	}
+	if h.Version > S3MVersion {
+		return nil, nil, nil, fmt.Errorf(
+			"binned model format version %d not supported", h.Version)
+	}
+	if _, err := LookupClasses(h.Classes, h.ClassDefs); err != nil {
+		return nil, nil, nil, err
+	}
+	p, err := decodePartitions(dec)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if err := p.check(); err != nil {
+		return nil, nil, nil, err
+	}
+	var m Model
+	if err := dec.Decode(&m); err != nil {
+		return nil, nil, nil, err
+	}
+	size := p.size()
+	if len(m.Class) != len(h.Classes) {
+		return nil, nil, nil, errors.New("class count mismatch")
+	}
+	for _, bins := range append([][]float64{m.SS}, m.Class...) {
+		if len(bins) != size {
+			return nil, nil, nil, errors.New("model size mismatch")
+		}
+	}
+	return &h, &m, p, nil
+}
+
+// readS3MText reads the text format.
+func readS3MText(br *bufio.Reader) (*S3MHeader, *Model, *Partitions, error) {
+	sc := bufio.NewScanner(br)
+	ln := 0
+	next := func() (string, error) {
+		if !sc.Scan() {
+			if err := sc.Err(); err != nil {
+				return "", err
+			}
+			return "", io.ErrUnexpectedEOF
+		}
+		ln++
+		return sc.Text(), nil
+	}
+	corrupt := func(err error) (*S3MHeader, *Model, *Partitions, error) {
+		return nil, nil, nil, fmt.Errorf("line %d: %v", ln, err)
+	}
+	if l, err := next(); err != nil {
+		return corrupt(err)
+	} else if l != s3mText {
+		return corrupt(errors.New(`"S3M binned" expected`))
+	}
+	var pt strings.Builder
+	for _, ele := range "qeih" {
+		l, err := next()
+		if err != nil {
+			return corrupt(err)
+		}
+		if len(l) < 1 || rune(l[0]) != ele {
+			return corrupt(fmt.Errorf("%c line expected", ele))
+		}
+		pt.WriteString(l + "\n")
+	}
+	p, err := ParsePartitions(strings.NewReader(pt.String()))
+	if err != nil {
+		return corrupt(err)
+	}
+	size := p.size()
+	readBins := func() ([]float64, error) {
+		bins := make([]float64, size)
+		for bx := 0; bx < size; {
+			l, err := next()
+			if err != nil {
+				return nil, err
+			}
+			f := strings.Fields(l)
+			if len(f) != len(p.H) {
+				return nil, fmt.Errorf("%d values, %d expected",
+					len(f), len(p.H))
+			}
+			for _, s := range f {
+				if bins[bx], err = strconv.ParseFloat(s, 64); err != nil {
+					return nil, err
+				}
+				bx++
+			}
+		}
+		return bins, nil
+	}
+	h := &S3MHeader{}
+	var m Model
+	if m.SS, err = readBins(); err != nil {
+		return corrupt(err)
+	}
+	// a class heading or definition and bins for each class, to the end of
+	// the file
+	for sc.Scan() {
+		ln++
+		l := sc.Text()
+		if cl, err := LookupClasses([]string{l}, nil); err == nil {
+			h.Classes = append(h.Classes, cl[0].Abbr)
+		} else if d, err := ParseClassDef(l); err == nil {
+			h.Classes = append(h.Classes, d.Abbr)
+			h.ClassDefs = append(h.ClassDefs, d)
+		} else {
+			return corrupt(fmt.Errorf("class heading or definition expected: %v",
+				err))
+		}
+		bins, err := readBins()
+		if err != nil {
+			return corrupt(err)
+		}
+		m.Class = append(m.Class, bins)
+	}
+	if err := sc.Err(); err != nil {
+		return corrupt(err)
+	}
+	if _, err := LookupClasses(h.Classes, h.ClassDefs); err != nil {
+		return corrupt(err)
+	}
+	return h, &m, p, nil
+}
@@ -0,0 +1,196 @@
+// Public domain.
+
+// Package d2build builds digest2 population models.
+//
+// A model combines a binned synthetic population, such as the S3M model read
+// from s3m.dat, with a population of known orbits.  The complete population
+// model, All, is the greater of the synthetic and known counts in each bin,
+// where known orbits are those with ephemeris uncertainty within AllArcsec.
+// It does not depend on the unknown models built.  An unknown population
+// model is built for each d2bin.UnkSpec as the synthetic count less known
+// orbits identifiable within the threshold of the spec.  Both are divided by
+// the square root of the bin volume.
+//
+// The package variables of d2bin defining partitions must be set before
+// building, typically by reading s3m.dat.
+package d2build
+
+import (
+	"errors"
+	"io"
+	"math"
+
+	"github.com/soniakeys/digest2/internal/catalog"
+	"github.com/soniakeys/digest2/internal/d2bin"
+	"github.com/soniakeys/unit"
+)
+
+// AllArcsec is the ephemeris uncertainty, in arc seconds, within which an
+// orbit is known for the complete population model.
+const AllArcsec = 60
+
+// Iterator iterates over known orbits.  Next returns io.EOF after the last
+// orbit.  Any other error stops Build.
+type Iterator interface {
+	Next() (catalog.Orbit, error)
+}
+
+// Builder accumulates known orbits for a model.
+type Builder struct {
+	S3M   *d2bin.Model
+	Specs []d2bin.UnkSpec
+	// Known holds the known population for each element of Specs.  KnownAll
+	// holds the known population of the complete model, orbits with
+	// ephemeris uncertainty within AllArcsec.
+	Known    []*d2bin.Model
+	KnownAll *d2bin.Model
+	// Cataloged holds every orbit in the model space, whatever its
+	// uncertainty, for measures of catalog completeness.
+	Cataloged *d2bin.Model
+	// Identified counts orbits identifiable in each element of Specs.
+	Identified []int
+	Used       int // number of orbits in the model space
+	OutOfModel int // number of orbits outside the model space
+}
+
+// NewBuilder returns a Builder for the synthetic population s3m and unknown
+// models specs.
+func NewBuilder(s3m *d2bin.Model, specs []d2bin.UnkSpec) *Builder {
+	b := &Builder{
+		S3M:        s3m,
+		Specs:      specs,
+		Known:      make([]*d2bin.Model, len(specs)),
+		KnownAll:   d2bin.New(),
+		Cataloged:  d2bin.New(),
+		Identified: make([]int, len(specs)),
+	}
+	for k := range b.Known {
+		b.Known[k] = d2bin.New()
+	}
+	return b
+}
+
+// Add adds a known orbit.  It returns false if the orbit is outside the
+// model space.
+//
+// The orbit counts as known in models where its ephemeris uncertainty is
+// within the threshold, using o.Unc for specs without an epoch and o.UncAt
+// for specs with one.
+func (b *Builder) Add(o catalog.Orbit) bool {
+	q := o.A * (1 - o.E)
+	iq, ie, ii, ih, inModel := d2bin.Qeih(q, o.E, o.I, o.H)
+	if !inModel {
+		b.OutOfModel++
+		return false
+	}
+	b.Used++
+	bx := d2bin.Mx(iq, ie, ii, ih)
+	var inClass []int
+	do := &d2bin.Orbit{Q: q, E: o.E, I: o.I, H: o.H,
+		Node: o.Node, Peri: o.Peri, Angles: o.Angles}
+	for c, cs := range d2bin.CList {
+		if cs.IsClass(do) {
+			inClass = append(inClass, c)
+		}
+	}
+	count := func(m *d2bin.Model) {
+		m.SS[bx]++
+		for _, c := range inClass {
+			m.Class[c][bx]++
+		}
+	}
+	count(b.Cataloged)
+	if o.UncOK && o.Unc <= AllArcsec {
+		count(b.KnownAll)
+	}
+	for k, sp := range b.Specs {
+		u, ok := o.Unc, o.UncOK
+		if sp.Epoch != 0 {
+			u, ok = o.UncAt(sp.Epoch)
+		}
+		if !ok || u > sp.Arcsec {
+			continue
+		}
+		b.Identified[k]++
+		count(b.Known[k])
+	}
+	return true
+}
+
+// Models combines the synthetic and known populations, returning the
+// complete population model and an unknown model for each element of Specs.
+//
+// all = max(s3m, known)/sqrt(v) and unk = max(s3m-known, 0)/sqrt(v), where v
+// is the volume of the bin.  All uses KnownAll, each unknown model uses the
+// corresponding element of Known.
+func (b *Builder) Models() (all *d2bin.Model, unk []*d2bin.Model) {
+	s3m := b.S3M
+	all = d2bin.New()
+	unk = make([]*d2bin.Model, len(b.Specs))
+	for k := range unk {
+		unk[k] = d2bin.New()
+	}
+	q0 := 0.
+	x := 0
+	for _, q1 := range d2bin.QPart {
+		dq := q1 - q0
+		q0 = q1
+		e0 := 0.
+		d1 := 1.
+		for _, e1 := range d2bin.EPart {
+			d0 := d1
+			d1 = 1 - e1
+			if d1 < 0 {
+				d1 = 0
+			}
+			dae := dq * (e1 - e0) / (d0 + d1)
+			e0 = e1
+			i0 := unit.Angle(0)
+			for _, i1 := range d2bin.IPart {
+				daei := dae * (i1 - i0).Deg()
+				i0 = i1
+				h0 := 0.
+				for _, h1 := range d2bin.HPart {
+					isqv := 1 / math.Sqrt(daei*(h1-h0))
+					h0 = h1
+					all.SS[x] = math.Max(b.KnownAll.SS[x], s3m.SS[x]) * isqv
+					for c, kc := range b.KnownAll.Class {
+						all.Class[c][x] = math.Max(kc[x], s3m.Class[c][x]) * isqv
+					}
+					for k, kn := range b.Known {
+						u := unk[k]
+						u.SS[x] = math.Max(s3m.SS[x]-kn.SS[x], 0) * isqv
+						for c, kc := range kn.Class {
+							u.Class[c][x] =
+								math.Max(s3m.Class[c][x]-kc[x], 0) * isqv
+						}
+					}
+					x++
+				}
+			}
+		}
+	}
+	return
+}
+
+// Build adds all orbits of it to a new Builder and returns the complete
+// population model and unknown models.  The Builder is returned as well for
+// its counts.
+func Build(s3m *d2bin.Model, specs []d2bin.UnkSpec, it Iterator) (all *d2bin.Model, unk []*d2bin.Model, b *Builder, err error) {
+	if len(specs) == 0 {
+		return nil, nil, nil, errors.New("no unknown model")
+	}
+	b = NewBuilder(s3m, specs)
+	for {
+		o, err := it.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		b.Add(o)
+	}
+	all, unk = b.Models()
+	return all, unk, b, nil
+}
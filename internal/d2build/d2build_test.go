@@ -0,0 +1,144 @@
+// Public domain.
+
+package d2build_test
+
+import (
+	"io"
+	"math"
+	"reflect"
+	"testing"
+
+	"github.com/soniakeys/digest2/internal/catalog"
+	"github.com/soniakeys/digest2/internal/d2bin"
+	"github.com/soniakeys/digest2/internal/d2build"
+	"github.com/soniakeys/unit"
+)
+
+// orbits is an Iterator over a slice.
+type orbits []catalog.Orbit
+
+func (o *orbits) Next() (catalog.Orbit, error) {
+	if len(*o) == 0 {
+		return catalog.Orbit{}, io.EOF
+	}
+	r := (*o)[0]
+	*o = (*o)[1:]
+	return r, nil
+}
+
+// tiny sets a model space of 16 bins, two for each element, with the built
+// in classes.  The partitions and classes are restored when t finishes.
+func tiny(t *testing.T) {
+	t.Cleanup(d2bin.CurrentPartitions().Set)
+	abbrs, defs := d2bin.ClassAbbrs(), d2bin.ClassDefs()
+	t.Cleanup(func() { d2bin.SetClasses(abbrs, defs) })
+	(&d2bin.Partitions{
+		Q: []float64{1, 2},
+		E: []float64{.5, 1.1},
+		I: []unit.Angle{unit.AngleFromDeg(90), unit.AngleFromDeg(180)},
+		H: []float64{1, 20},
+	}).Set()
+	builtIn := make([]string, len(d2bin.Classes))
+	for x, c := range d2bin.Classes {
+		builtIn[x] = c.Abbr
+	}
+	if err := d2bin.SetClasses(builtIn, nil); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBuild(t *testing.T) {
+	tiny(t)
+	s3m := d2bin.New()
+	for x := range s3m.SS {
+		s3m.SS[x] = 4
+	}
+	// volume of bin 0 is 1 * .5/(1+.5) * 90 * 1 = 30
+	isqv := 1 / math.Sqrt(30)
+	a := func(q, e float64) float64 { return q / (1 - e) }
+	specs := []d2bin.UnkSpec{{Name: `10"`, Arcsec: 10}, {Name: "1'", Arcsec: 60}}
+	it := &orbits{
+		// bin 0, identifiable in both
+		{A: a(.5, .1), E: .1, I: unit.AngleFromDeg(10), H: .5, Unc: 5, UncOK: true},
+		// bin 0, identifiable within 1'
+		{A: a(.5, .1), E: .1, I: unit.AngleFromDeg(10), H: .5, Unc: 30, UncOK: true},
+		// out of model
+		{A: a(3, .1), E: .1, I: unit.AngleFromDeg(10), H: .5, Unc: 5, UncOK: true},
+		// no valid uncertainty
+		{A: a(.5, .1), E: .1, I: unit.AngleFromDeg(10), H: .5},
+	}
+	all, unk, b, err := d2build.Build(s3m, specs, it)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.Used != 3 || b.OutOfModel != 1 ||
+		b.Identified[0] != 1 || b.Identified[1] != 2 {
+		t.Fatalf("%+v", b)
+	}
+	// cataloged includes the orbit without valid uncertainty
+	if b.Cataloged.SS[0] != 3 || b.KnownAll.SS[0] != 2 {
+		t.Fatal(b.Cataloged.SS[0], b.KnownAll.SS[0])
+	}
+	if len(unk) != 2 {
+		t.Fatal(len(unk), "unknown models")
+	}
+	near := func(got, want float64) bool { return math.Abs(got-want) < 1e-12 }
+	if !near(all.SS[0], 4*isqv) || !near(unk[0].SS[0], 3*isqv) ||
+		!near(unk[1].SS[0], 2*isqv) {
+		t.Fatal(all.SS[0], unk[0].SS[0], unk[1].SS[0])
+	}
+	// q < 1.3 is a NEO.  Known NEOs exceed S3M NEOs, which are 0.
+	neo := 1
+	if !near(all.Class[neo][0], 2*isqv) || unk[1].Class[neo][0] != 0 {
+		t.Fatal(all.Class[neo][0], unk[1].Class[neo][0])
+	}
+}
+
+func TestBuildEpoch(t *testing.T) {
+	tiny(t)
+	specs := []d2bin.UnkSpec{
+		{Name: "1'", Arcsec: 60, Epoch: 100},
+		{Name: "1'", Arcsec: 60, Epoch: 300},
+	}
+	b := d2build.NewBuilder(d2bin.New(), specs)
+	b.Add(catalog.Orbit{A: 1, E: .1, I: unit.AngleFromDeg(10), H: .5,
+		Hist: []catalog.UncPoint{{MJD: 100, Unc: 10}, {MJD: 300, Unc: 100}}})
+	if b.Identified[0] != 1 || b.Identified[1] != 0 {
+		t.Fatal(b.Identified)
+	}
+}
+
+// The complete population does not depend on the unknown models built.
+func TestBuildAllIndependent(t *testing.T) {
+	tiny(t)
+	s3m := d2bin.New()
+	a := func(q, e float64) float64 { return q / (1 - e) }
+	cat := []catalog.Orbit{
+		{A: a(.5, .1), E: .1, I: unit.AngleFromDeg(10), H: .5, Unc: 5, UncOK: true},
+		{A: a(.5, .1), E: .1, I: unit.AngleFromDeg(10), H: .5, Unc: 30, UncOK: true},
+		{A: a(.5, .1), E: .1, I: unit.AngleFromDeg(10), H: .5, Unc: 300, UncOK: true},
+		{A: a(1.5, .7), E: .7, I: unit.AngleFromDeg(100), H: 10, Unc: 500, UncOK: true},
+	}
+	build := func(specs []d2bin.UnkSpec) *d2bin.Model {
+		it := append(orbits{}, cat...)
+		all, _, _, err := d2build.Build(s3m, specs, &it)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return all
+	}
+	one := build([]d2bin.UnkSpec{{Name: "1'", Arcsec: 60}})
+	three := build([]d2bin.UnkSpec{
+		{Name: `10"`, Arcsec: 10},
+		{Name: "1'", Arcsec: 60},
+		{Name: "10'", Arcsec: 600},
+	})
+	if !reflect.DeepEqual(one, three) {
+		t.Fatal("complete population depends on unknown models")
+	}
+	// 5" and 30" orbits are known, 300" is not.
+	isqv := 1 / math.Sqrt(30)
+	if math.Abs(one.SS[0]-2*isqv) > 1e-12 {
+		t.Fatal(one.SS[0] / isqv)
+	}
+}
@@ -0,0 +1,359 @@
+// Public domain.
+
+// Package d2fetch downloads data files such as astorb.dat and the MPC
+// obscode list.
+//
+// A Fetcher tries a list of mirror URLs in order.  Supported schemes are
+// http, https, and file.  Downloads go to a partial file next to the
+// destination and are resumed with an HTTP range request if a partial file
+// is present from an earlier attempt at the same URL.  A partial file from
+// a different URL is discarded.  Gzip compressed content is detected and
+// decompressed.  An optional SHA-256 checksum is verified before the
+// destination file is written.
+package d2fetch
+
+import (
+	"bufio"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrOffline is returned when a fetch would require network access in
+// offline mode.
+var ErrOffline = errors.New("offline mode, network access not allowed")
+
+// Fetcher holds settings for downloading a file.
+type Fetcher struct {
+	// URLs are tried in order until one succeeds.
+	URLs []string
+	// SHA256, if not empty, is the hex encoded checksum of the content as
+	// served, that is, before any decompression.
+	SHA256 string
+	// Offline disallows http and https URLs.  File URLs are still used.
+	Offline bool
+	// Progress, if not nil, receives progress messages.
+	Progress io.Writer
+	// Client is used for http and https.  If nil, http.DefaultClient is used.
+	Client *http.Client
+}
+
+// SplitURLs splits a comma separated list of URLs, as might be given on a
+// command line or in an environment variable.
+func SplitURLs(s string) (u []string) {
+	for _, f := range strings.Split(s, ",") {
+		if f = strings.TrimSpace(f); f > "" {
+			u = append(u, f)
+		}
+	}
+	return
+}
+
+// Fetch downloads to the file dst.
+//
+// If all URLs fail, the error from the last attempt is returned.
+func (f *Fetcher) Fetch(dst string) error {
+	if len(f.URLs) == 0 {
+		return errors.New("no URL to fetch " + dst)
+	}
+	var err error
+	for _, u := range f.URLs {
+		if err = f.fetch1(u, dst); err == nil {
+			return nil
+		}
+		f.logf("%s: %v\n", u, err)
+	}
+	return err
+}
+
+func (f *Fetcher) logf(format string, a ...interface{}) {
+	if f.Progress != nil {
+		fmt.Fprintf(f.Progress, format, a...)
+	}
+}
+
+// fetch1 fetches a single URL.
+func (f *Fetcher) fetch1(rawURL, dst string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return err
+	}
+	switch u.Scheme {
+	case "http", "https":
+		if f.Offline {
+			return ErrOffline
+		}
+	case "file":
+	default:
+		return fmt.Errorf("unsupported URL scheme %q", u.Scheme)
+	}
+	part := dst + ".part"
+	src := part + ".url"
+	if err = startPart(part, src, rawURL); err != nil {
+		return err
+	}
+	if u.Scheme == "file" {
+		err = f.getFile(u.Path, part)
+	} else {
+		err = f.getHTTP(rawURL, part)
+	}
+	if err != nil {
+		return err // leave partial file for resume
+	}
+	if f.SHA256 > "" {
+		if err = checkSum(part, f.SHA256); err != nil {
+			// no use resuming a bad file
+			os.Remove(part)
+			os.Remove(src)
+			return err
+		}
+	}
+	if err = finish(part, dst); err != nil {
+		return err
+	}
+	return os.Remove(src)
+}
+
+// startPart prepares to download rawURL to file part.  File src records
+// the URL of the partial file.  A partial file from a different URL, or
+// from an unknown one, is removed as a range of it would not be meaningful.
+func startPart(part, src, rawURL string) error {
+	if b, err := ioutil.ReadFile(src); err == nil && string(b) == rawURL {
+		return nil
+	}
+	if err := os.Remove(part); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return ioutil.WriteFile(src, []byte(rawURL), 0644)
+}
+
+// getHTTP downloads to file part, resuming if part exists.
+func (f *Fetcher) getHTTP(rawURL, part string) error {
+	c := f.Client
+	if c == nil {
+		c = http.DefaultClient
+	}
+	req, err := http.NewRequest("GET", rawURL, nil)
+	if err != nil {
+		return err
+	}
+	var have int64
+	if fi, err := os.Stat(part); err == nil {
+		have = fi.Size()
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", have))
+	}
+	// ask for content as stored.  transparent decompression by
+	// the http package would make ranges and checksums meaningless.
+	req.Header.Set("Accept-Encoding", "identity")
+	resp, err := c.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	flag := os.O_WRONLY | os.O_CREATE
+	total := resp.ContentLength
+	switch resp.StatusCode {
+	case http.StatusOK:
+		have = 0 // server sent the whole thing
+		flag |= os.O_TRUNC
+	case http.StatusPartialContent:
+		first, _, ok := contentRange(resp.Header.Get("Content-Range"))
+		if !ok || first != have {
+			os.Remove(part)
+			return fmt.Errorf("range %q does not resume at %d bytes",
+				resp.Header.Get("Content-Range"), have)
+		}
+		flag |= os.O_APPEND
+		if total >= 0 {
+			total += have
+		}
+		f.logf("resuming at %d bytes\n", have)
+	case http.StatusRequestedRangeNotSatisfiable:
+		// the partial file is complete if it is the size of the content.
+		// otherwise the content has changed and the download starts over.
+		if _, size, ok := contentRange(resp.Header.Get("Content-Range")); ok &&
+			size == have {
+			return nil
+		}
+		if have == 0 {
+			return errors.New(resp.Status)
+		}
+		if err := os.Remove(part); err != nil {
+			return err
+		}
+		f.logf("partial file does not match, restarting\n")
+		return f.getHTTP(rawURL, part)
+	default:
+		return errors.New(resp.Status)
+	}
+	return f.copyTo(part, flag, resp.Body, have, total)
+}
+
+// contentRange parses Content-Range header value h.  first is the first
+// byte of the range, or -1 for "*".  size is the complete size, or -1 if
+// not known.
+func contentRange(h string) (first, size int64, ok bool) {
+	const unit = "bytes "
+	if !strings.HasPrefix(h, unit) {
+		return
+	}
+	h = h[len(unit):]
+	i := strings.IndexByte(h, '/')
+	if i < 0 {
+		return
+	}
+	size = -1
+	var err error
+	if s := h[i+1:]; s != "*" {
+		if size, err = strconv.ParseInt(s, 10, 64); err != nil {
+			return
+		}
+	}
+	if h[:i] == "*" {
+		return -1, size, true
+	}
+	j := strings.IndexByte(h[:i], '-')
+	if j < 0 {
+		return
+	}
+	first, err = strconv.ParseInt(h[:j], 10, 64)
+	return first, size, err == nil
+}
+
+// getFile copies from a local file, resuming if part exists.
+func (f *Fetcher) getFile(src, part string) error {
+	sf, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer sf.Close()
+	fi, err := sf.Stat()
+	if err != nil {
+		return err
+	}
+	var have int64
+	flag := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	if pi, err := os.Stat(part); err == nil && pi.Size() <= fi.Size() {
+		have = pi.Size()
+		if _, err = sf.Seek(have, io.SeekStart); err != nil {
+			return err
+		}
+		flag = os.O_WRONLY | os.O_APPEND
+	}
+	return f.copyTo(part, flag, sf, have, fi.Size())
+}
+
+// copyTo copies r to file fn, reporting progress.  have is the number of
+// bytes already in fn, total is the expected complete size or -1 if unknown.
+func (f *Fetcher) copyTo(fn string, flag int, r io.Reader, have, total int64) error {
+	w, err := os.OpenFile(fn, flag, 0644)
+	if err != nil {
+		return err
+	}
+	var dst io.Writer = w
+	if f.Progress != nil {
+		p := &progress{w: f.Progress, n: have, total: total}
+		dst = io.MultiWriter(w, p)
+		defer p.done()
+	}
+	if _, err = io.Copy(dst, r); err != nil {
+		w.Close()
+		return err
+	}
+	return w.Close()
+}
+
+// progress reports bytes copied, at most about once a second.
+type progress struct {
+	w        io.Writer
+	n, total int64
+	last     time.Time
+}
+
+func (p *progress) Write(b []byte) (int, error) {
+	p.n += int64(len(b))
+	if time.Since(p.last) >= time.Second {
+		p.last = time.Now()
+		p.report()
+	}
+	return len(b), nil
+}
+
+func (p *progress) report() {
+	if p.total > 0 {
+		fmt.Fprintf(p.w, "\r%.1f of %.1f MB (%.0f%%)", float64(p.n)/1e6,
+			float64(p.total)/1e6, float64(p.n)*100/float64(p.total))
+	} else {
+		fmt.Fprintf(p.w, "\r%.1f MB", float64(p.n)/1e6)
+	}
+}
+
+func (p *progress) done() {
+	p.report()
+	fmt.Fprintln(p.w)
+}
+
+// checkSum verifies the SHA-256 checksum of file fn.
+func checkSum(fn, want string) error {
+	f, err := os.Open(fn)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err = io.Copy(h, f); err != nil {
+		return err
+	}
+	if got := hex.EncodeToString(h.Sum(nil)); !strings.EqualFold(got, want) {
+		return fmt.Errorf("checksum mismatch, got %s want %s", got, want)
+	}
+	return nil
+}
+
+// finish moves the complete download part to dst, decompressing it
+// if it is gzip compressed.
+func finish(part, dst string) error {
+	pf, err := os.Open(part)
+	if err != nil {
+		return err
+	}
+	br := bufio.NewReader(pf)
+	magic, _ := br.Peek(2)
+	if len(magic) < 2 || magic[0] != 0x1f || magic[1] != 0x8b {
+		pf.Close()
+		return os.Rename(part, dst)
+	}
+	zr, err := gzip.NewReader(br)
+	if err != nil {
+		pf.Close()
+		return err
+	}
+	tmp := dst + ".tmp"
+	tf, err := os.Create(tmp)
+	if err == nil {
+		if _, err = io.Copy(tf, zr); err == nil {
+			err = tf.Close()
+		} else {
+			tf.Close()
+		}
+	}
+	pf.Close()
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err = os.Rename(tmp, dst); err != nil {
+		return err
+	}
+	return os.Remove(part)
+}
@@ -0,0 +1,277 @@
+// Public domain.
+
+package d2fetch_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/soniakeys/digest2/internal/d2fetch"
+)
+
+var content = []byte(strings.Repeat("astorb line\n", 1000))
+
+func gz(b []byte) []byte {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	w.Write(b)
+	w.Close()
+	return buf.Bytes()
+}
+
+// server serves content with range support at /plain and gzipped at /gz.
+// it counts requests with a Range header.
+func server(t *testing.T, ranges *int) *httptest.Server {
+	z := gz(content)
+	return httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Range") > "" {
+				*ranges++
+			}
+			switch r.URL.Path {
+			case "/plain":
+				http.ServeContent(w, r, "plain", time.Time{},
+					bytes.NewReader(content))
+			case "/gz":
+				http.ServeContent(w, r, "gz", time.Time{}, bytes.NewReader(z))
+			default:
+				http.NotFound(w, r)
+			}
+		}))
+}
+
+func check(t *testing.T, fn string) {
+	b, err := ioutil.ReadFile(fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(b, content) {
+		t.Fatal("content mismatch")
+	}
+	for _, ext := range []string{".part", ".part.url"} {
+		if _, err := os.Stat(fn + ext); !os.IsNotExist(err) {
+			t.Fatal(ext, "file left behind")
+		}
+	}
+}
+
+func TestFetch(t *testing.T) {
+	var ranges int
+	s := server(t, &ranges)
+	defer s.Close()
+	dir, err := ioutil.TempDir("", "d2fetch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	dst := filepath.Join(dir, "astorb.dat")
+
+	// first mirror fails, second is gzipped
+	f := &d2fetch.Fetcher{URLs: []string{s.URL + "/missing", s.URL + "/gz"}}
+	if err := f.Fetch(dst); err != nil {
+		t.Fatal(err)
+	}
+	check(t, dst)
+	if ranges != 0 {
+		t.Fatal("range requests:", ranges)
+	}
+}
+
+// flaky drops the connection after the first cut bytes of first on the
+// first request.  Later requests are served later, with range support
+// unless badRange is set.  It counts requests with a Range header.
+type flaky struct {
+	first, later []byte
+	cut          int
+	badRange     bool
+	n, ranges    int
+}
+
+func (h *flaky) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.n++
+	if r.Header.Get("Range") > "" {
+		h.ranges++
+	}
+	switch {
+	case h.n == 1:
+		w.Header().Set("Content-Length", strconv.Itoa(len(h.first)))
+		w.Write(h.first[:h.cut])
+	case h.badRange:
+		w.Header().Set("Content-Range",
+			fmt.Sprintf("bytes 0-%d/%d", len(h.later)-1, len(h.later)))
+		w.WriteHeader(http.StatusPartialContent)
+		w.Write(h.later)
+	default:
+		http.ServeContent(w, r, "flaky", time.Time{}, bytes.NewReader(h.later))
+	}
+}
+
+// interrupted starts a download of h to dst that is cut short.
+func interrupted(t *testing.T, h *flaky, dst string) *httptest.Server {
+	s := httptest.NewServer(h)
+	f := &d2fetch.Fetcher{URLs: []string{s.URL}}
+	if err := f.Fetch(dst); err == nil {
+		s.Close()
+		t.Fatal("expected interrupted download")
+	}
+	return s
+}
+
+func tempDst(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "d2fetch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	return filepath.Join(dir, "astorb.dat")
+}
+
+func TestResume(t *testing.T) {
+	dst := tempDst(t)
+	h := &flaky{first: content, later: content, cut: 100}
+	s := interrupted(t, h, dst)
+	defer s.Close()
+	var prog bytes.Buffer
+	f := &d2fetch.Fetcher{URLs: []string{s.URL}, Progress: &prog}
+	if err := f.Fetch(dst); err != nil {
+		t.Fatal(err)
+	}
+	check(t, dst)
+	if h.ranges != 1 {
+		t.Fatal("range requests:", h.ranges)
+	}
+	if !strings.Contains(prog.String(), "resuming at 100 bytes") {
+		t.Fatal("progress:", prog.String())
+	}
+}
+
+func TestMirrorChange(t *testing.T) {
+	dst := tempDst(t)
+	s1 := interrupted(t, &flaky{first: content, later: content, cut: 100},
+		dst)
+	defer s1.Close()
+	var ranges int
+	s2 := server(t, &ranges)
+	defer s2.Close()
+	f := &d2fetch.Fetcher{URLs: []string{s2.URL + "/plain"}}
+	if err := f.Fetch(dst); err != nil {
+		t.Fatal(err)
+	}
+	check(t, dst)
+	if ranges != 0 {
+		t.Fatal("partial file from another mirror resumed")
+	}
+}
+
+func TestRangeNotSatisfiable(t *testing.T) {
+	changed := append(append([]byte{}, content...), content[:200]...)
+	for _, tc := range []struct {
+		name  string
+		first []byte
+		cut   int
+	}{
+		{"complete", append(append([]byte{}, content...), 'x'), len(content)},
+		{"changed", changed, len(content) + 100},
+	} {
+		dst := tempDst(t)
+		h := &flaky{first: tc.first, later: content, cut: tc.cut}
+		s := interrupted(t, h, dst)
+		f := &d2fetch.Fetcher{URLs: []string{s.URL}}
+		if err := f.Fetch(dst); err != nil {
+			t.Fatal(tc.name, err)
+		}
+		s.Close()
+		check(t, dst)
+		if h.ranges != 1 {
+			t.Fatal(tc.name, "range requests:", h.ranges)
+		}
+	}
+}
+
+func TestBadContentRange(t *testing.T) {
+	dst := tempDst(t)
+	h := &flaky{first: content, later: content, cut: 100, badRange: true}
+	s := interrupted(t, h, dst)
+	defer s.Close()
+	f := &d2fetch.Fetcher{URLs: []string{s.URL}}
+	if err := f.Fetch(dst); err == nil {
+		t.Fatal("expected error for range not starting at partial size")
+	}
+	// partial file is discarded, the next attempt starts over
+	if err := f.Fetch(dst); err != nil {
+		t.Fatal(err)
+	}
+	check(t, dst)
+}
+
+func TestChecksum(t *testing.T) {
+	var ranges int
+	s := server(t, &ranges)
+	defer s.Close()
+	dir, err := ioutil.TempDir("", "d2fetch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	dst := filepath.Join(dir, "astorb.dat")
+	sum := sha256.Sum256(content)
+	f := &d2fetch.Fetcher{
+		URLs:   []string{s.URL + "/gz"}, // served content differs
+		SHA256: hex.EncodeToString(sum[:]),
+	}
+	if err := f.Fetch(dst); err == nil {
+		t.Fatal("expected checksum error")
+	}
+	if _, err := os.Stat(dst); !os.IsNotExist(err) {
+		t.Fatal("file written despite bad checksum")
+	}
+	f.URLs = append(f.URLs, s.URL+"/plain")
+	if err := f.Fetch(dst); err != nil {
+		t.Fatal(err)
+	}
+	check(t, dst)
+}
+
+func TestOffline(t *testing.T) {
+	var ranges int
+	s := server(t, &ranges)
+	defer s.Close()
+	dir, err := ioutil.TempDir("", "d2fetch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	src := filepath.Join(dir, "mirror.gz")
+	if err := ioutil.WriteFile(src, gz(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	dst := filepath.Join(dir, "astorb.dat")
+	f := &d2fetch.Fetcher{URLs: []string{s.URL + "/plain"}, Offline: true}
+	if err := f.Fetch(dst); err != d2fetch.ErrOffline {
+		t.Fatal("want ErrOffline, got", err)
+	}
+	f.URLs = append(f.URLs, "file://"+filepath.ToSlash(src))
+	if err := f.Fetch(dst); err != nil {
+		t.Fatal(err)
+	}
+	check(t, dst)
+}
+
+func TestSplitURLs(t *testing.T) {
+	u := d2fetch.SplitURLs(" http://a/x, ,file:///b ")
+	if len(u) != 2 || u[0] != "http://a/x" || u[1] != "file:///b" {
+		t.Fatal(u)
+	}
+}
@@ -0,0 +1,150 @@
+// Public domain.
+
+// Package d2path locates data and configuration files used by digest2 and
+// its utility programs.
+//
+// Files not given explicitly on a command line are searched for in order:
+//
+//   1. Directories listed in the environment variable DIGEST2_PATH.
+//   2. XDG base directories.  For configuration files these are
+//      $XDG_CONFIG_HOME/digest2 (default ~/.config/digest2) then
+//      digest2 under each directory of $XDG_CONFIG_DIRS (default /etc/xdg).
+//      For data files they are $XDG_DATA_HOME/digest2 (default
+//      ~/.local/share/digest2) then digest2 under each directory of
+//      $XDG_DATA_DIRS (default /usr/local/share:/usr/share).
+//   3. The directory of the running executable.
+//   4. For GOPATH builds, the digest2 source directory.  s3m.dat is looked
+//      for in the muk subdirectory.
+//
+// Explicit command line options are handled by the programs and take
+// precedence over all of these.
+package d2path
+
+import (
+	"go/build"
+	"os"
+	"path/filepath"
+)
+
+// Kind distinguishes configuration files from data files.  They are
+// searched for in different XDG directories.
+type Kind int
+
+const (
+	Data Kind = iota
+	Config
+)
+
+// EnvPath is the name of the environment variable listing directories
+// to search.
+const EnvPath = "DIGEST2_PATH"
+
+// parentImport is the GOPATH import path of the digest2 source directory.
+const parentImport = "digest2"
+
+// Candidate is a location for a file and a description of where the
+// location came from.
+type Candidate struct {
+	Path   string
+	Source string
+}
+
+// Search returns the locations searched for file name fn, in search order.
+func Search(fn string, k Kind) (c []Candidate) {
+	for _, d := range filepath.SplitList(os.Getenv(EnvPath)) {
+		if d > "" {
+			c = append(c, Candidate{filepath.Join(d, fn), EnvPath})
+		}
+	}
+	homeVar, dirsVar, homeDef, dirsDef := "XDG_DATA_HOME", "XDG_DATA_DIRS",
+		filepath.Join(".local", "share"), "/usr/local/share:/usr/share"
+	if k == Config {
+		homeVar, dirsVar, homeDef, dirsDef = "XDG_CONFIG_HOME",
+			"XDG_CONFIG_DIRS", ".config", "/etc/xdg"
+	}
+	if d := xdgHome(homeVar, homeDef); d > "" {
+		c = append(c, Candidate{filepath.Join(d, "digest2", fn), homeVar})
+	}
+	dirs := os.Getenv(dirsVar)
+	if dirs == "" {
+		dirs = dirsDef
+	}
+	for _, d := range filepath.SplitList(dirs) {
+		if d > "" {
+			c = append(c, Candidate{filepath.Join(d, "digest2", fn), dirsVar})
+		}
+	}
+	if exe, err := os.Executable(); err == nil {
+		if r, err := filepath.EvalSymlinks(exe); err == nil {
+			exe = r
+		}
+		c = append(c, Candidate{filepath.Join(filepath.Dir(exe), fn),
+			"executable directory"})
+	}
+	if pkg, err := build.Import(parentImport, "", build.FindOnly); err == nil {
+		d := pkg.Dir
+		if fn == "s3m.dat" {
+			d = filepath.Join(d, "muk")
+		}
+		c = append(c, Candidate{filepath.Join(d, fn), "source directory"})
+	}
+	return
+}
+
+// xdgHome returns the value of an XDG home directory variable, or the
+// default relative to the user home directory.
+func xdgHome(v, def string) string {
+	if d := os.Getenv(v); d > "" {
+		return d
+	}
+	if h, err := os.UserHomeDir(); err == nil {
+		return filepath.Join(h, def)
+	}
+	return ""
+}
+
+// Find searches for file name fn.
+//
+// If found, the location is returned with ok = true.  Otherwise the
+// location returned is the Default location for the file, with ok = false.
+func Find(fn string, k Kind) (c Candidate, ok bool) {
+	for _, c := range Search(fn, k) {
+		if Exists(c.Path) {
+			return c, true
+		}
+	}
+	return Default(fn, k), false
+}
+
+// Default returns the location where a program should create file fn.
+// This is the first directory of DIGEST2_PATH if set, otherwise the XDG
+// home directory.  The directory may not exist.  See MkdirFor.
+func Default(fn string, k Kind) Candidate {
+	for _, d := range filepath.SplitList(os.Getenv(EnvPath)) {
+		if d > "" {
+			return Candidate{filepath.Join(d, fn), EnvPath}
+		}
+	}
+	homeVar, homeDef := "XDG_DATA_HOME", filepath.Join(".local", "share")
+	if k == Config {
+		homeVar, homeDef = "XDG_CONFIG_HOME", ".config"
+	}
+	return Candidate{filepath.Join(xdgHome(homeVar, homeDef), "digest2", fn),
+		homeVar}
+}
+
+// MkdirFor creates the directory for file path p if it does not exist.
+func MkdirFor(p string) error {
+	return os.MkdirAll(filepath.Dir(p), 0755)
+}
+
+// Exists returns true if path p exists and is not a directory.
+func Exists(p string) bool {
+	fi, err := os.Stat(p)
+	return err == nil && !fi.IsDir()
+}
+
+// String formats a candidate for display.
+func (c Candidate) String() string {
+	return c.Path + " (" + c.Source + ")"
+}
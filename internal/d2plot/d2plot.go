@@ -0,0 +1,277 @@
+// Public domain.
+
+// Package d2plot renders digest2 bin models as SVG heatmaps.
+//
+// A heatmap is a two dimensional projection of the four dimensional q, e, i,
+// H model space.  Population counts are summed over the two dimensions not
+// shown.  Cells are drawn equal size by partition index rather than scaled
+// to the partition values, which vary widely in size.
+package d2plot
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+
+	"github.com/soniakeys/digest2/internal/d2bin"
+)
+
+// Axis identifies an orbital element used as a heatmap axis.
+type Axis int
+
+// Axes available for projection.  Q, E, I, and H are model dimensions.
+// A, semimajor axis, is not a model dimension.  Bins are placed on the
+// A axis by the value of a computed at the center of the q and e bin, using
+// the q partitions as the partitions of a.  Bins with e >= 1 at the center
+// are not shown on the A axis.
+const (
+	Q Axis = iota
+	E
+	I
+	H
+	A
+)
+
+var axisName = []string{"q", "e", "i", "H", "a"}
+var axisLabel = []string{"q (AU)", "e", "i (deg)", "H", "a (AU)"}
+
+func (x Axis) String() string {
+	if x < 0 || int(x) >= len(axisName) {
+		return fmt.Sprintf("Axis(%d)", int(x))
+	}
+	return axisName[x]
+}
+
+// ParseAxis returns the Axis for one of the names q, e, i, H, or a.
+// H may also be given as h.
+func ParseAxis(s string) (Axis, error) {
+	if s == "h" {
+		return H, nil
+	}
+	for x, n := range axisName {
+		if s == n {
+			return Axis(x), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown axis %q, want one of q, e, i, H, a", s)
+}
+
+// edges returns partition boundaries for an axis, starting with 0.
+// For H, the first bin is open below but is drawn starting at 0 as it is
+// when muk computes bin volumes.
+func (x Axis) edges() []float64 {
+	ed := []float64{0}
+	switch x {
+	case Q, A:
+		ed = append(ed, d2bin.QPart...)
+	case E:
+		ed = append(ed, d2bin.EPart...)
+	case I:
+		for _, p := range d2bin.IPart {
+			ed = append(ed, p.Deg())
+		}
+	case H:
+		ed = append(ed, d2bin.HPart...)
+	}
+	return ed
+}
+
+// Plot holds the data and options for rendering a single heatmap.
+type Plot struct {
+	X, Y  Axis
+	Pop   []float64    // flat model population, such as Model.SS
+	Tags  map[int]bool // optional bins to outline, by flat model index
+	Title string
+}
+
+// cell computes the X, Y cell indexes for flat model index bx.
+func (p *Plot) cell(bx int) (cx, cy int, ok bool) {
+	nh := len(d2bin.HPart)
+	ni := len(d2bin.IPart)
+	ne := len(d2bin.EPart)
+	ih := bx % nh
+	ii := bx / nh % ni
+	ie := bx / nh / ni % ne
+	iq := bx / nh / ni / ne
+	ix := func(x Axis) (int, bool) {
+		switch x {
+		case Q:
+			return iq, true
+		case E:
+			return ie, true
+		case I:
+			return ii, true
+		case H:
+			return ih, true
+		}
+		// A.  locate center of q, e bin in the q partitions
+		qe := Q.edges()
+		ee := E.edges()
+		ec := (ee[ie] + ee[ie+1]) * .5
+		if ec >= 1 {
+			return 0, false
+		}
+		a := (qe[iq] + qe[iq+1]) * .5 / (1 - ec)
+		for ia, q := range d2bin.QPart {
+			if a < q {
+				return ia, true
+			}
+		}
+		return 0, false
+	}
+	if cx, ok = ix(p.X); ok {
+		cy, ok = ix(p.Y)
+	}
+	return
+}
+
+// geometry of the drawing, in SVG user units
+const (
+	cellSize   = 24
+	marginLeft = 70
+	marginTop  = 40
+	marginBot  = 60
+	legendW    = 90
+)
+
+// WriteSVG renders the plot as a standalone SVG document.
+//
+// Package variables of d2bin describing the model shape must be set, as they
+// are after d2bin.ReadFile.
+func (p *Plot) WriteSVG(w io.Writer) error {
+	if len(p.Pop) != d2bin.MSize {
+		return errors.New("population size does not match model size")
+	}
+	if p.X == p.Y {
+		return errors.New("X and Y axes must be different")
+	}
+	xe := p.X.edges()
+	ye := p.Y.edges()
+	nx := len(xe) - 1
+	ny := len(ye) - 1
+	sum := make([][]float64, nx)
+	tag := make([][]bool, nx)
+	for x := range sum {
+		sum[x] = make([]float64, ny)
+		tag[x] = make([]bool, ny)
+	}
+	for bx, n := range p.Pop {
+		cx, cy, ok := p.cell(bx)
+		if !ok {
+			continue
+		}
+		sum[cx][cy] += n
+		if p.Tags[bx] {
+			tag[cx][cy] = true
+		}
+	}
+	var max float64
+	for _, col := range sum {
+		for _, n := range col {
+			if n > max {
+				max = n
+			}
+		}
+	}
+	pw := nx * cellSize
+	ph := ny * cellSize
+	width := marginLeft + pw + legendW
+	height := marginTop + ph + marginBot
+
+	b := &strings.Builder{}
+	fmt.Fprintf(b, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" font-family="sans-serif" font-size="10">
+`, width, height)
+	fmt.Fprintf(b, "<rect width=\"%d\" height=\"%d\" fill=\"white\"/>\n",
+		width, height)
+	if p.Title > "" {
+		fmt.Fprintf(b, "<text x=\"%d\" y=\"20\" font-size=\"14\">%s</text>\n",
+			marginLeft, escape(p.Title))
+	}
+	// cells.  y increases upward, so row 0 is drawn at the bottom.
+	for x, col := range sum {
+		for y, n := range col {
+			fmt.Fprintf(b, "<rect x=\"%d\" y=\"%d\" width=\"%d\" height=\"%d\" fill=\"%s\"><title>%s %g-%g, %s %g-%g: %.4g</title></rect>\n",
+				marginLeft+x*cellSize, marginTop+(ny-1-y)*cellSize,
+				cellSize, cellSize, color(n, max),
+				p.X, xe[x], xe[x+1], p.Y, ye[y], ye[y+1], n)
+		}
+	}
+	// tagged cell outlines, drawn after all cells so they are not covered.
+	for x, col := range tag {
+		for y, t := range col {
+			if t {
+				fmt.Fprintf(b, "<rect x=\"%d\" y=\"%d\" width=\"%d\" height=\"%d\" fill=\"none\" stroke=\"red\" stroke-width=\"2\"/>\n",
+					marginLeft+x*cellSize+1, marginTop+(ny-1-y)*cellSize+1,
+					cellSize-2, cellSize-2)
+			}
+		}
+	}
+	// frame, ticks, and labels
+	fmt.Fprintf(b, "<rect x=\"%d\" y=\"%d\" width=\"%d\" height=\"%d\" fill=\"none\" stroke=\"black\"/>\n",
+		marginLeft, marginTop, pw, ph)
+	for x, v := range xe {
+		px := marginLeft + x*cellSize
+		fmt.Fprintf(b, "<text x=\"%d\" y=\"%d\" text-anchor=\"end\" transform=\"rotate(-60 %d %d)\">%g</text>\n",
+			px, marginTop+ph+12, px, marginTop+ph+12, v)
+	}
+	for y, v := range ye {
+		py := marginTop + (ny-y)*cellSize
+		fmt.Fprintf(b, "<text x=\"%d\" y=\"%d\" text-anchor=\"end\">%g</text>\n",
+			marginLeft-4, py+3, v)
+	}
+	fmt.Fprintf(b, "<text x=\"%d\" y=\"%d\" text-anchor=\"middle\" font-size=\"12\">%s</text>\n",
+		marginLeft+pw/2, height-8, axisLabel[p.X])
+	fmt.Fprintf(b, "<text x=\"16\" y=\"%d\" text-anchor=\"middle\" font-size=\"12\" transform=\"rotate(-90 16 %d)\">%s</text>\n",
+		marginTop+ph/2, marginTop+ph/2, axisLabel[p.Y])
+	// legend, a log scale from max down four decades
+	lx := marginLeft + pw + 20
+	const steps = 8
+	for s := 0; s <= steps; s++ {
+		v := max * math.Pow(10, -4*float64(s)/steps)
+		fmt.Fprintf(b, "<rect x=\"%d\" y=\"%d\" width=\"14\" height=\"%d\" fill=\"%s\"/>\n",
+			lx, marginTop+s*cellSize, cellSize, color(v, max))
+		fmt.Fprintf(b, "<text x=\"%d\" y=\"%d\">%.3g</text>\n",
+			lx+18, marginTop+s*cellSize+cellSize/2+3, v)
+	}
+	b.WriteString("</svg>\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// color maps n to a fill color on a log scale covering four decades
+// below max.  Zero is white.
+func color(n, max float64) string {
+	if !(n > 0) || !(max > 0) {
+		return "#ffffff"
+	}
+	f := 1 + math.Log10(n/max)/4 // 1 at max, 0 four decades down
+	if f < 0 {
+		f = 0
+	}
+	// interpolate a ramp from pale yellow through orange to dark purple.
+	ramp := [][3]float64{
+		{255, 255, 204},
+		{254, 178, 76},
+		{240, 59, 32},
+		{84, 39, 143},
+	}
+	s := f * float64(len(ramp)-1)
+	i := int(s)
+	if i >= len(ramp)-1 {
+		i = len(ramp) - 2
+	}
+	t := s - float64(i)
+	c0, c1 := ramp[i], ramp[i+1]
+	return fmt.Sprintf("#%02x%02x%02x",
+		int(c0[0]+(c1[0]-c0[0])*t),
+		int(c0[1]+(c1[1]-c0[1])*t),
+		int(c0[2]+(c1[2]-c0[2])*t))
+}
+
+var escaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+
+func escape(s string) string {
+	return escaper.Replace(s)
+}
@@ -0,0 +1,57 @@
+// Public domain.
+
+package d2plot_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/soniakeys/digest2/internal/d2bin"
+	"github.com/soniakeys/digest2/internal/d2plot"
+	"github.com/soniakeys/unit"
+)
+
+func TestWriteSVG(t *testing.T) {
+	t.Cleanup(d2bin.CurrentPartitions().Set)
+	(&d2bin.Partitions{
+		Q: []float64{1, 2, 3},
+		E: []float64{.5, 1.1},
+		I: []unit.Angle{unit.AngleFromDeg(180)},
+		H: []float64{15, 20},
+	}).Set()
+	m := d2bin.New()
+	for x := range m.SS {
+		m.SS[x] = float64(x)
+	}
+	p := d2plot.Plot{
+		X:    d2plot.A,
+		Y:    d2plot.H,
+		Pop:  m.SS,
+		Tags: map[int]bool{d2bin.Mx(1, 0, 0, 1): true},
+	}
+	var b strings.Builder
+	if err := p.WriteSVG(&b); err != nil {
+		t.Fatal(err)
+	}
+	svg := b.String()
+	if !strings.HasPrefix(svg, "<svg") || !strings.HasSuffix(svg, "</svg>\n") {
+		t.Fatal("not an svg document")
+	}
+	// 3 a cells by 2 H cells
+	if n := strings.Count(svg, "<title>"); n != 6 {
+		t.Fatal("cells:", n)
+	}
+	if n := strings.Count(svg, `stroke="red"`); n != 1 {
+		t.Fatal("tagged cells:", n)
+	}
+	// bins with a in 2-3 are q bin 1, e bin 0, a = 1.5/.75 = 2, and
+	// q bin 0, e bin 1, a = .5/.2 = 2.5.  At H bin 0, flat indexes are
+	// Mx(1, 0, 0, 0) = 4 and Mx(0, 1, 0, 0) = 2.
+	if !strings.Contains(svg, "a 2-3, H 0-15: 6<") {
+		t.Error("a 2-3, H 0-15 cell not found or wrong")
+	}
+	p.Y = d2plot.A
+	if err := p.WriteSVG(&b); err == nil {
+		t.Error("expected error for same axes")
+	}
+}
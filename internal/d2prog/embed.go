@@ -0,0 +1,17 @@
+// Public domain.
+
+//go:build embed
+// +build embed
+
+package d2prog
+
+import _ "embed"
+
+// Default data files compiled into the binary.  Build with -tags embed
+// after copying the files here with go generate.  See gen_embed.go.
+
+//go:embed digest2.gmodel
+var embeddedModel []byte
+
+//go:embed digest2.obscodes
+var embeddedObscodes []byte
@@ -0,0 +1,59 @@
+// Public domain.
+
+//go:build ignore
+// +build ignore
+
+// gen_embed copies digest2.gmodel and digest2.obscodes into the d2prog
+// package directory so they can be compiled into the digest2 binary with
+// the embed build tag.
+//
+// Usage:
+//
+//   go generate ./internal/d2prog
+//   go build -tags embed
+//
+// By default files are copied from the digest2 source directory.  A different
+// source directory can be given as a command line argument.
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/soniakeys/exit"
+)
+
+func main() {
+	defer exit.Handler()
+	// go generate runs in the package directory, two levels below
+	// the digest2 source directory.
+	src := filepath.Join("..", "..")
+	if len(os.Args) > 1 {
+		src = os.Args[1]
+	}
+	for _, fn := range []string{"digest2.gmodel", "digest2.obscodes"} {
+		if err := copyFile(fn, filepath.Join(src, fn)); err != nil {
+			exit.Log(err)
+		}
+		fmt.Println("copied", filepath.Join(src, fn))
+	}
+}
+
+func copyFile(dst, src string) error {
+	fs, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer fs.Close()
+	fd, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(fd, fs); err != nil {
+		fd.Close()
+		return err
+	}
+	return fd.Close()
+}
@@ -4,10 +4,12 @@ package d2prog
 
 import (
 	"bufio"
+	"bytes"
+	"errors"
 	"flag"
 	"fmt"
-	"go/build"
 	"io"
+	"io/ioutil"
 	"log"
 	"os"
 	"path/filepath"
@@ -20,6 +22,8 @@ import (
 	xrand "golang.org/x/exp/rand"
 
 	"github.com/soniakeys/digest2/internal/d2bin"
+	"github.com/soniakeys/digest2/internal/d2fetch"
+	"github.com/soniakeys/digest2/internal/d2path"
 	"github.com/soniakeys/digest2/internal/d2solver"
 	"github.com/soniakeys/exit"
 	"github.com/soniakeys/mpcformat"
@@ -27,7 +31,8 @@ import (
 	"github.com/soniakeys/unit"
 )
 
-const parentImport = "digest2"
+//go:generate go run gen_embed.go
+
 const versionString = "digest2 version 0.16 Go source."
 const copyrightString = "Public domain."
 
@@ -36,18 +41,47 @@ func Main() {
 
 	// these functions all set up package vars and terminate on error
 	cl := parseCommandLine()
-	all, unk, aoDate, aoLines := readModel(cl)
+	if cl.paths {
+		printPaths(cl)
+		os.Exit(0)
+	}
+	model, mSrc, mb := readModel(cl)
 	if cl.v {
-		fmt.Printf("Astorb.dat %s, %d lines.\n",
-			aoDate.Format("2 Jan 2006"), aoLines)
+		fmt.Printf("Orbit catalog %s %s, %d orbits.\n", model.Catalog,
+			model.CatalogDate.Format("2 Jan 2006"), model.CatalogOrbits)
+		fmt.Println("Model:", mSrc)
+		if !model.AsOf.IsZero() {
+			fmt.Println("Known orbits as of", model.AsOf.Format("2006-01-02"))
+		}
+		fmt.Print("NoID models:")
+		for _, g := range model.UnkGroups() {
+			fmt.Print(" ", g.Name)
+			if g.Epochs[0] != 0 {
+				fmt.Printf(" (%d epochs %s to %s)", len(g.Epochs),
+					mjdDate(g.Epochs[0]), mjdDate(g.Epochs[len(g.Epochs)-1]))
+			}
+		}
+		fmt.Println()
+		fmt.Println("Orbit classes:", strings.Join(model.Classes, " "))
+		fmt.Println("Obscodes:", ocdSource(cl))
 		os.Exit(0)
 	}
-	ocdMap := readOcd(cl)
-	classCompute, repeatable, obsErrMap, obsErrDefault, opt :=
-		readConfig(cl, ocdMap)
-
-	solver := d2solver.New(
-		all, unk, classCompute, obsErrMap, obsErrDefault)
+	ocdMap, ob := readOcd(cl)
+	cf, cb := readConfig(cl, ocdMap, &model.Header)
+	opt := cf.opt
+
+	current.Store(&snapshot{
+		model:    model,
+		ocdMap:   ocdMap,
+		cf:       cf,
+		solver:   newSolver(model, cf),
+		modelFP:  fingerprint(mb),
+		ocdFP:    fingerprint(ob),
+		configFP: fingerprint(cb),
+	})
+	if cl.reload || cl.watch > 0 {
+		go watchReload(cl, cl.watch)
+	}
 
 	// open obs file
 	var f *os.File
@@ -72,7 +106,7 @@ func Main() {
 	// and terminates immediately.
 	arcChIn := make(chan *observation.Arc)
 	errCh := make(chan error)
-	go splitter(f, ocdMap, arcChIn, errCh)
+	go splitter(f, arcChIn, errCh)
 
 	// prCh is used to keep processed results in submission order.
 	// it is a buffered channel so that a fast worker can drop off the
@@ -89,12 +123,13 @@ func Main() {
 	// for each arc, attach a return channel that works like a ticket
 	// for picking up the result of processing the arc.  wait for an
 	// available worker, send the arc to the worker and drop the
-	// ticket in the queue for printing.
+	// ticket in the queue for printing.  the arc is solved with the
+	// snapshot current at this time.
 	go func() {
 		for a := range arcChIn { // for each arc to be solved
-			rch := make(chan string, 1) // create return channel for arc
-			arcChSeq <- &arcSeq{a, rch} // queue arc for solving
-			prCh <- rch                 // queue return channel for printing
+			rch := make(chan string, 1)                    // create return channel for arc
+			arcChSeq <- &arcSeq{a, rch, currentSnapshot()} // queue arc for solving
+			prCh <- rch                                    // queue return channel for printing
 		}
 		close(prCh)
 	}()
@@ -110,7 +145,7 @@ func Main() {
 			if !ok {
 				return
 			}
-			go solve(solver, a, arcChSeq, repeatable, opt)
+			go solve(a, arcChSeq, cf.repeatable)
 		}
 	}()
 
@@ -141,15 +176,37 @@ func Main() {
 }
 
 type arcSeq struct {
-	a   *observation.Arc
-	rch chan string
+	a    *observation.Arc
+	rch  chan string
+	snap *snapshot
 }
 
-// parse errors and invalid arcs are dropped without notification.
-func splitter(iObs io.Reader, ocdMap observation.ParallaxMap, arcCh chan *observation.Arc, errCh chan error) {
-	for s := mpcformat.ArcSplitter(iObs, ocdMap); ; {
+// parse errors and invalid arcs are dropped without notification, except
+// for streaks and motion lines, which are logged.
+//
+// pMap, the obscodes used for parsing, is private to the splitter.  When
+// obscodes are reloaded it is updated between arcs.
+func splitter(iObs io.Reader, arcCh chan *observation.Arc, errCh chan error) {
+	snap := currentSnapshot()
+	pMap := observation.ParallaxMap{}
+	copyOcd := func() {
+		for k := range pMap {
+			delete(pMap, k)
+		}
+		for k, v := range snap.ocdMap {
+			pMap[k] = v
+		}
+	}
+	copyOcd()
+	mr := newMotionReader(iObs)
+	for s := mpcformat.ArcSplitter(mr, pMap); ; {
+		if c := currentSnapshot(); c.ocdFP != snap.ocdFP {
+			snap = c
+			copyOcd()
+		}
 		a, err := s()
 		if err == nil {
+			mr.streaks(a)
 			sendValid(a, arcCh)
 			continue
 		}
@@ -166,25 +223,38 @@ func splitter(iObs io.Reader, ocdMap observation.ParallaxMap, arcCh chan *observ
 }
 
 // checks that observations make a valid arc, allocates and sends.
+//
+// an arc of a single observation is valid if it is a streak with motion.
 func sendValid(a *observation.Arc, arcCh chan *observation.Arc) {
-	if len(a.Obs) < 2 {
+	switch len(a.Obs) {
+	case 0:
 		return
-	}
-	// the first observation time must be positive and
-	// observation times must increase after that
-	var t0 float64
-	for _, o := range a.Obs {
-		t := o.Meas().MJD
-		if t <= t0 {
+	case 1:
+		s, ok := a.Obs[0].(*d2solver.Streak)
+		if !ok {
+			return
+		}
+		if !(s.Rate > 0) || !(s.Meas().MJD > 0) {
+			log.Print(a.Desig, ": streak without motion or date, skipped")
+			return
+		}
+	default:
+		// the first observation time must be positive and
+		// observation times must increase after that
+		var t0 float64
+		for _, o := range a.Obs {
+			t := o.Meas().MJD
+			if t <= t0 {
+				return
+			}
+			t0 = t
+		}
+		// object must show motion over the arc
+		first := a.Obs[0].Meas()
+		last := a.Obs[len(a.Obs)-1].Meas()
+		if first.RA == last.RA && first.Dec == last.Dec {
 			return
 		}
-		t0 = t
-	}
-	// object must show motion over the arc
-	first := a.Obs[0].Meas()
-	last := a.Obs[len(a.Obs)-1].Meas()
-	if first.RA == last.RA && first.Dec == last.Dec {
-		return
 	}
 	arcCh <- &observation.Arc{
 		Desig: a.Desig,
@@ -195,11 +265,9 @@ func sendValid(a *observation.Arc, arcCh chan *observation.Arc) {
 // worker process, solves arcs.
 // the first arc to solve will be waiting in arcCh.
 // additional arc are requested by sending arcCh back over avCh.
-func solve(solver *d2solver.D2Solver,
-	a *arcSeq, // first arc to solve
+func solve(a *arcSeq, // first arc to solve
 	arcCh chan *arcSeq, // channel for getting more arcs
-	repeatable bool,
-	opt *outputOptions) {
+	repeatable bool) {
 	rnd := xrand.New(&xrand.PCGSource{})
 	if !repeatable {
 		rnd.Seed(uint64(time.Now().UnixNano()))
@@ -231,7 +299,8 @@ func solve(solver *d2solver.D2Solver,
 			vmag = 21
 		}
 
-		rms, classScores := solver.Solve(a.a, vmag, rnd)
+		opt := a.snap.cf.opt
+		rms, classScores, ind := a.snap.solver.Solve(a.a, vmag, rnd)
 
 		// build output line
 		ol := fmt.Sprintf("%7s", a.a.Desig)
@@ -242,16 +311,24 @@ func solve(solver *d2solver.D2Solver,
 				ol += " **.**"
 			}
 		}
+		if opt.unbound {
+			ol = fmt.Sprintf("%s %3.0f %3.0f", ol, ind.Unbound, ind.Far)
+		}
+		if opt.geo {
+			ol = fmt.Sprintf("%s %3.0f", ol, ind.Geo)
+		}
+		if opt.curvature {
+			var pruned float64
+			if ind.Samples > 0 {
+				pruned = 100 * float64(ind.Pruned) / float64(ind.Samples)
+			}
+			ol = fmt.Sprintf("%s %3.0f", ol, pruned)
+		}
 		if opt.classPossible {
 			// specified columns first
 			for _, c := range opt.classColumn {
 				cs := classScores[c]
-				if opt.raw {
-					ol = fmt.Sprintf("%s %3.0f", ol, cs.Raw)
-				}
-				if opt.noid {
-					ol = fmt.Sprintf("%s %3.0f", ol, cs.NoId)
-				}
+				ol = opt.scores(ol, cs)
 			}
 			// then other possibilities
 		clist:
@@ -265,7 +342,7 @@ func solve(solver *d2solver.D2Solver,
 				cs := classScores[c]
 				var pScore float64
 				if opt.noid {
-					pScore = cs.NoId
+					pScore = cs.NoId[opt.noidModels[0]]
 				} else {
 					pScore = cs.Raw
 				}
@@ -278,12 +355,7 @@ func solve(solver *d2solver.D2Solver,
 		} else {
 			// other possibilities not computed.
 			for _, cs := range classScores {
-				if opt.raw {
-					ol = fmt.Sprintf("%s %3.0f", ol, cs.Raw)
-				}
-				if opt.noid {
-					ol = fmt.Sprintf("%s %3.0f", ol, cs.NoId)
-				}
+				ol = opt.scores(ol, cs)
 			}
 		}
 
@@ -293,33 +365,38 @@ func solve(solver *d2solver.D2Solver,
 }
 
 type commandLine struct {
-	dc    string // config file
-	dm    string // model file
-	do    string // obscode file
-	dp    string // default path
-	fnObs string // observations
-	v     bool   // -v option
+	dc     string        // config file
+	dm     string        // model file
+	do     string        // obscode file
+	dp     string        // default path
+	fnObs  string        // observations
+	v      bool          // -v option
+	paths  bool          // paths command
+	reload bool          // -r option
+	watch  time.Duration // -w option
 }
 
+// default file names
+const (
+	ocdFn    = "digest2.obscodes"
+	configFn = "digest2.config"
+)
+
 func parseCommandLine() *commandLine {
-	// Package path of digest2/go is used for a few things.
-	// There's not actually a package here, but it's the parent directory
-	// for all commands and packages associated with digest2.
-	pp, ppErr := build.Import(parentImport, "", build.FindOnly)
 	var cl commandLine
-	if ppErr == nil {
-		cl.dp = pp.Dir
-	}
 	dh := flag.Bool("h", false, "")
 	dv := flag.Bool("v", false, "")
 	flag.StringVar(&cl.dc, "c", "", "")
 	flag.StringVar(&cl.dm, "m", "", "")
 	flag.StringVar(&cl.do, "o", "", "")
-	flag.StringVar(&cl.dp, "p", cl.dp, "")
+	flag.StringVar(&cl.dp, "p", "", "")
+	flag.BoolVar(&cl.reload, "r", false, "")
+	flag.DurationVar(&cl.watch, "w", 0, "")
 	flag.Usage = func() {
 		os.Stderr.WriteString(`
 Usage: digest2 [options] <obsfile>    score observations in file
        digest2 [options] -            score observations from stdin
+       digest2 [options] paths        show file locations
        digest2 -h                     display help and quick reference
        digest2 -v                     display version and copyright
 
@@ -328,12 +405,9 @@ Options:
        -m <model-file>
        -o <obscode-file>
        -p <path>
+       -r                  reload files on SIGHUP
+       -w <interval>       reload files when changed, checking at interval
 `)
-		if ppErr == nil {
-			os.Stderr.WriteString(`
-Default:
-       -p=` + pp.Dir + "\n")
-		}
 	}
 	flag.Parse()
 	switch {
@@ -349,57 +423,259 @@ Default:
 		os.Exit(1)
 	}
 	cl.fnObs = flag.Arg(0)
+	// to score a file named "paths", use ./paths
+	cl.paths = cl.fnObs == "paths"
 	return &cl
 }
 
-func readOcd(cl *commandLine) observation.ParallaxMap {
-	ocdFile := cl.fixupCP(cl.do, "digest2.obscodes")
-	ocdMap, readErr := mpcformat.ReadObscodeDatFile(ocdFile)
+// locate returns the location to use for a data or config file.
+//
+// A file specified with an option is used as given.  Otherwise a path
+// specified with -p is used.  Otherwise the file is searched for as
+// described in package d2path.  Found is true if the file exists.
+// If it does not, the location is where it should be created.
+func (cl *commandLine) locate(fnSpec, fnDefault string, k d2path.Kind) (c d2path.Candidate, found bool) {
+	switch {
+	case fnSpec > "":
+		c = d2path.Candidate{Path: fnSpec, Source: "command line"}
+	case cl.dp > "":
+		c = d2path.Candidate{
+			Path:   filepath.Join(cl.dp, fnDefault),
+			Source: "-p option",
+		}
+	default:
+		return d2path.Find(fnDefault, k)
+	}
+	return c, d2path.Exists(c.Path)
+}
+
+// explicit is true if a location was given on the command line for a file
+// specified with fnSpec.
+func (cl *commandLine) explicit(fnSpec string) bool {
+	return fnSpec > "" || cl.dp > ""
+}
+
+// printPaths implements the paths command, showing the locations searched
+// for each file and which location is used.
+func printPaths(cl *commandLine) {
+	for _, f := range []struct {
+		spec, fn string
+		k        d2path.Kind
+		embedded []byte
+		missing  string
+	}{
+		{cl.dm, d2bin.Mfn, d2path.Data, embeddedModel, "not found"},
+		{cl.do, ocdFn, d2path.Data, embeddedObscodes, "not found, will download"},
+		{cl.dc, configFn, d2path.Config, nil, "not found, defaults used"},
+		{"", d2bin.Sfn, d2path.Data, nil, "not found (used only by muk)"},
+	} {
+		fmt.Println(f.fn)
+		// -p does not apply to s3m.dat.  it is always searched for.
+		var cs []d2path.Candidate
+		if f.fn == d2bin.Sfn || !cl.explicit(f.spec) {
+			cs = d2path.Search(f.fn, f.k)
+		} else {
+			c, _ := cl.locate(f.spec, f.fn, f.k)
+			cs = []d2path.Candidate{c}
+		}
+		found := false
+		for _, c := range cs {
+			mark := " "
+			if !found && d2path.Exists(c.Path) {
+				found = true
+				mark = "*"
+			}
+			fmt.Printf("  %s %s\n", mark, c)
+		}
+		switch {
+		case found:
+		case f.embedded != nil && !cl.explicit(f.spec):
+			fmt.Println("  *", embeddedSource)
+		default:
+			fmt.Println("   ", f.missing)
+		}
+	}
+}
+
+// name of source used for embedded data files
+const embeddedSource = "embedded copy"
+
+func readOcd(cl *commandLine) (ocdMap observation.ParallaxMap, content []byte) {
+	c, found := cl.locate(cl.do, ocdFn, d2path.Data)
+	ocdFile := c.Path
+	content, readErr := ioutil.ReadFile(ocdFile)
 	if readErr == nil {
-		return ocdMap
+		if ocdMap, readErr = mpcformat.ReadObscodeDat(
+			bytes.NewReader(content)); readErr == nil {
+			return
+		}
+	}
+	// a file on disk takes precedence, but if there is none and no
+	// location was specified, an embedded copy is preferred over downloading.
+	if !found && !cl.explicit(cl.do) && embeddedObscodes != nil {
+		ocdMap, err := mpcformat.ReadObscodeDat(
+			bytes.NewReader(embeddedObscodes))
+		if err != nil {
+			exit.Log(err)
+		}
+		return ocdMap, embeddedObscodes
 	}
 	// that didn't work.  try getting a fresh copy.
-	if err := mpcformat.FetchObscodeDat(ocdFile); err != nil {
+	if err := d2path.MkdirFor(ocdFile); err != nil {
+		exit.Log(err)
+	}
+	f := &d2fetch.Fetcher{
+		URLs:    d2fetch.SplitURLs(os.Getenv("DIGEST2_OBSCODES_URL")),
+		Offline: os.Getenv("DIGEST2_OFFLINE") > "",
+	}
+	if len(f.URLs) == 0 {
+		f.URLs = []string{mpcformat.ObscodeDatURL}
+	}
+	if err := f.Fetch(ocdFile); err != nil {
 		log.Println(readErr) // show error from read attempt,
 		exit.Log(err)        // and error from download attempt
 	}
 	// retry with downloaded file.  see if this copy works better
-	if ocdMap, readErr = mpcformat.ReadObscodeDatFile(ocdFile); readErr != nil {
+	if content, readErr = ioutil.ReadFile(ocdFile); readErr != nil {
+		exit.Log(readErr)
+	}
+	if ocdMap, readErr = mpcformat.ReadObscodeDat(
+		bytes.NewReader(content)); readErr != nil {
 		exit.Log(readErr)
 	}
-	return ocdMap
+	return
+}
+
+// ocdContent returns the obscode file content readOcd would use, without
+// downloading.
+func ocdContent(cl *commandLine) ([]byte, error) {
+	c, found := cl.locate(cl.do, ocdFn, d2path.Data)
+	if !found && !cl.explicit(cl.do) && embeddedObscodes != nil {
+		return embeddedObscodes, nil
+	}
+	return ioutil.ReadFile(c.Path)
+}
+
+// ocdSource describes the source readOcd would use, for -v.
+func ocdSource(cl *commandLine) string {
+	c, found := cl.locate(cl.do, ocdFn, d2path.Data)
+	switch {
+	case found, cl.explicit(cl.do):
+		return c.String()
+	case embeddedObscodes != nil:
+		return embeddedSource
+	}
+	return c.Path + " (not present, will download)"
+}
+
+// newSolver creates a solver for model with the settings of config cf.
+func newSolver(model *d2bin.File, cf *config) *d2solver.D2Solver {
+	s := d2solver.New(model, cf.classCompute, cf.obsErrMap, cf.obsErrDefault)
+	s.Curvature = cf.opt.curvature
+	s.Unbound = cf.opt.unbound
+	s.Geo = cf.opt.geo
+	return s
 }
 
 type outputOptions struct {
-	headings, rms, raw, noid, classPossible bool
-	classColumn                             []int
+	headings, rms, unbound, geo, curvature, raw, noid, classPossible bool
+	classColumn                                                      []int
+	noidModels                                                       []int // unknown model indexes
+	noidNames                                                        []string
+}
+
+// scores appends raw and NoID scores for a class column to output line ol.
+func (opt *outputOptions) scores(ol string, cs d2solver.Scores) string {
+	if opt.raw {
+		ol = fmt.Sprintf("%s %3.0f", ol, cs.Raw)
+	}
+	if opt.noid {
+		for _, u := range opt.noidModels {
+			ol = fmt.Sprintf("%s %3.0f", ol, cs.NoId[u])
+		}
+	}
+	return ol
+}
+
+// nScores is the number of scores output for each class column.
+func (opt *outputOptions) nScores() (n int) {
+	if opt.raw {
+		n++
+	}
+	if opt.noid {
+		n += len(opt.noidModels)
+	}
+	return
+}
+
+// config holds settings from the config file.
+type config struct {
+	classCompute  []int
+	repeatable    bool
+	obsErrMap     map[string]unit.Angle
+	obsErrDefault unit.Angle
+	opt           *outputOptions
+}
+
+// readConfig locates and parses the config file.  Content is the file content
+// read, nil if there is no config file and defaults are used.
+func readConfig(cl *commandLine, ocdMap observation.ParallaxMap, h *d2bin.Header) (cf *config, content []byte) {
+	content, err := configContent(cl)
+	if err != nil {
+		exit.Log(err)
+	}
+	if cf, err = parseConfig(content, ocdMap, h); err != nil {
+		exit.Log(err)
+	}
+	return
+}
+
+// configContent returns the config file content, nil if there is no config
+// file and defaults are used.
+func configContent(cl *commandLine) ([]byte, error) {
+	c, found := cl.locate(cl.dc, configFn, d2path.Config)
+	if !found && cl.dc == "" {
+		return nil, nil
+	}
+	return ioutil.ReadFile(c.Path)
 }
 
-func readConfig(cl *commandLine, ocdMap observation.ParallaxMap) (classCompute []int, repeatable bool,
-	obsErrMap map[string]unit.Angle, obsErrDefault unit.Angle,
-	opt *outputOptions) {
-	// default observational error = 1 arc sec
-	obsErrDefault = unit.AngleFromSec(1)
-	obsErrMap = make(map[string]unit.Angle)
-	opt = new(outputOptions)
+// parseConfig parses config file content b.  Empty content gives the
+// default configuration.
+func parseConfig(b []byte, ocdMap observation.ParallaxMap, h *d2bin.Header) (cf *config, err error) {
+	cf = &config{
+		// default observational error = 1 arc sec
+		obsErrDefault: unit.AngleFromSec(1),
+		obsErrMap:     make(map[string]unit.Angle),
+		opt:           new(outputOptions),
+	}
+	opt := cf.opt
 	// default configuration
 	opt.classPossible = true
-	classCompute = make([]int, len(d2bin.CList))
-	for i := range classCompute {
-		classCompute[i] = i
+	cf.classCompute = make([]int, len(d2bin.CList))
+	for i := range cf.classCompute {
+		cf.classCompute[i] = i
+	}
+	// default columns, MPC Int .. N18 and PHA, those of the model
+	for cx, c := range d2bin.CList {
+		switch c.Abbr {
+		case "Int", "NEO", "N22", "N18", "PHA":
+			opt.classColumn = append(opt.classColumn, cx)
+		}
 	}
-	opt.classColumn = classCompute[:4] // MPC Int .. N18
 	opt.headings = true
 	opt.rms = true
 	opt.noid = true
-	f, err := os.Open(cl.fixupCP(cl.dc, "digest2.config"))
-	if err != nil {
-		if cl.dc == "" {
-			return
+	// by default NoID scores use the first unknown model
+	defer func() {
+		if len(opt.noidModels) == 0 {
+			opt.noidModels = []int{0}
 		}
-		exit.Log(err)
-	}
-	defer f.Close()
+		groups := h.UnkGroups()
+		for _, u := range opt.noidModels {
+			opt.noidNames = append(opt.noidNames, groups[u].Name)
+		}
+	}()
 
 	rxObserr := regexp.MustCompile(`^[ \t]*(.*?)[ \t]*=[ \t]*(.+)$`)
 	parseObsErr := func(s string) (parseErr string) {
@@ -415,7 +691,7 @@ func readConfig(cl *commandLine, ocdMap observation.ParallaxMap) (classCompute [
 			return "Observational error > 10 arc seconds not allowed."
 		}
 		if ss[1] == "" {
-			obsErrDefault = unit.AngleFromSec(oe)
+			cf.obsErrDefault = unit.AngleFromSec(oe)
 			return ""
 		}
 		// replace or remove this check if code is changed in
@@ -425,24 +701,24 @@ func readConfig(cl *commandLine, ocdMap observation.ParallaxMap) (classCompute [
 		if !ok {
 			return "Obscode not recognized."
 		}
-		obsErrMap[ss[1]] = unit.AngleFromSec(oe)
+		cf.obsErrMap[ss[1]] = unit.AngleFromSec(oe)
 		return ""
 	}
 
 	var rawSpec, classSpec bool
 read:
-	for lr := bufio.NewReader(f); ; {
+	for lr := bufio.NewReader(bytes.NewReader(b)); ; {
 		l, isPre, err := lr.ReadLine()
 		switch {
 		case err == io.EOF:
 			if classSpec && !opt.classPossible {
-				classCompute = opt.classColumn
+				cf.classCompute = opt.classColumn
 			}
-			return
+			return cf, nil
 		case err != nil:
-			exit.Log(err)
+			return nil, err
 		case isPre:
-			exit.Log("Unexpected long line in config file.")
+			return nil, errors.New("Unexpected long line in config file.")
 		case len(l) == 0:
 			continue
 		case l[0] == '#':
@@ -462,6 +738,24 @@ read:
 		case "norms":
 			opt.rms = false
 			continue
+		case "unbound":
+			opt.unbound = true
+			continue
+		case "nounbound":
+			opt.unbound = false
+			continue
+		case "geo":
+			opt.geo = true
+			continue
+		case "nogeo":
+			opt.geo = false
+			continue
+		case "curvature":
+			opt.curvature = true
+			continue
+		case "nocurvature":
+			opt.curvature = false
+			continue
 		case "raw":
 			if !rawSpec {
 				rawSpec = true
@@ -484,16 +778,38 @@ read:
 			opt.classPossible = true
 			continue
 		case "repeatable":
-			repeatable = true
+			cf.repeatable = true
 			continue
 		case "random":
-			repeatable = false
+			cf.repeatable = false
+			continue
+		}
+		if f := strings.Fields(ls); len(f) > 1 && f[0] == "noid" {
+			if !rawSpec {
+				rawSpec = true
+				opt.raw = false
+			}
+			opt.noid = true
+			for _, n := range f[1:] {
+				if n == "all" {
+					for u := range h.UnkGroups() {
+						opt.noidModels = append(opt.noidModels, u)
+					}
+					continue
+				}
+				u := h.UnkIndex(n)
+				if u < 0 {
+					return nil, errors.New("NoID model " + n +
+						" not in model file.\nConfig file line: " + ls)
+				}
+				opt.noidModels = append(opt.noidModels, u)
+			}
 			continue
 		}
 		if strings.HasPrefix(ls, "obserr") {
 			errStr := parseObsErr(ls[6:])
 			if errStr > "" {
-				exit.Log(fmt.Sprintf("%s\nConfig file line: %s", errStr, ls))
+				return nil, fmt.Errorf("%s\nConfig file line: %s", errStr, ls)
 			}
 			continue
 		}
@@ -509,22 +825,40 @@ read:
 				continue read
 			}
 		}
-		exit.Log("Unrecognized line in config file: " + ls)
+		if _, err := d2bin.LookupClasses([]string{ls}, nil); err == nil {
+			return nil, errors.New("Orbit class not in model: " + ls +
+				"\nThe model was built from a binned S3M without it.  " +
+				"Regenerate the binned S3M with s3mbin and the model " +
+				"with muk to score it.")
+		}
+		return nil, errors.New("Unrecognized line in config file: " + ls)
 	}
-	return
 }
 
 func printHeadings(opt *outputOptions) {
 	if opt.headings {
 		fmt.Println(versionString)
 		// heading line 1
-		if opt.raw && opt.noid && len(opt.classColumn) > 0 {
+		n := opt.nScores()
+		if n > 1 && len(opt.classColumn) > 0 {
 			fmt.Print("-------")
 			if opt.rms {
 				fmt.Print("  ----")
 			}
+			if opt.unbound {
+				fmt.Print(" -------")
+			}
+			if opt.geo {
+				fmt.Print(" ---")
+			}
+			if opt.curvature {
+				fmt.Print(" ---")
+			}
+			// center abbreviation over the scores for the class
+			w := 4 * n
+			l := (w - 2) / 2
 			for _, c := range opt.classColumn {
-				fmt.Printf("   %3s  ", d2bin.CList[c].Abbr)
+				fmt.Printf("%*s%3s%*s", l, "", d2bin.CList[c].Abbr, w-l-3, "")
 			}
 			if opt.classPossible {
 				fmt.Println(" ---------------")
@@ -537,11 +871,29 @@ func printHeadings(opt *outputOptions) {
 		if opt.rms {
 			fmt.Printf("   RMS")
 		}
+		if opt.unbound {
+			fmt.Print(" Unb U11")
+		}
+		if opt.geo {
+			fmt.Print(" Geo")
+		}
+		if opt.curvature {
+			fmt.Print(" Prn")
+		}
 		for _, c := range opt.classColumn {
-			if opt.raw && opt.noid {
-				fmt.Print(" Raw NID")
-			} else {
+			if n == 1 {
 				fmt.Printf(" %3s", d2bin.CList[c].Abbr)
+				continue
+			}
+			if opt.raw {
+				fmt.Print(" Raw")
+			}
+			if opt.noid && len(opt.noidModels) == 1 {
+				fmt.Print(" NID")
+			} else if opt.noid {
+				for _, nn := range opt.noidNames {
+					fmt.Printf(" %3s", nn)
+				}
 			}
 		}
 		switch {
@@ -555,27 +907,27 @@ func printHeadings(opt *outputOptions) {
 	}
 }
 
-func (cl *commandLine) fixupCP(fnSpec, fnDefault string) string {
-	if fnSpec > "" {
-		return fnSpec
-	}
-	return filepath.Join(cl.dp, fnDefault)
-}
-
 func printHelp() {
 	fmt.Println(`
 Digest2 uses statistical ranging techniques on short arc astrometry to
 compute probabilities that observed objects are of various orbit classes.
 Input is a file of 80 column MPC-format observations, with at least two
-observations per object.  Output is orbit class scores for each object.
+observations per object or one followed by a motion line for a streak.
+Output is orbit class scores for each object.
 
 Config file keywords:
    headings
    noheadings
    rms
    norms
+   unbound
+   nounbound
+   geo
+   nogeo
+   curvature
+   nocurvature
    raw
-   noid
+   noid [<model> ...]
    repeatable
    random
    poss
@@ -591,13 +943,36 @@ For full documentation:
 }
 
 //  reads population model (created by muk)
-func readModel(cl *commandLine) (all, unk d2bin.Model, aoDate time.Time, aoLines int) {
-	var err error
-	all, unk, aoDate, aoLines, err =
-		d2bin.ReadFile(cl.fixupCP(cl.dm, d2bin.Mfn))
+//
+// a file on disk takes precedence.  if there is none and no location was
+// specified, an embedded copy is used if present.  source returned describes
+// the file location or is embeddedSource.  content is the model file content.
+func readModel(cl *commandLine) (model *d2bin.File, source string, content []byte) {
+	content, source, err := modelContent(cl)
+	if err == nil {
+		if model, err = d2bin.Read(bytes.NewReader(content)); err != nil &&
+			source != embeddedSource {
+			err = fmt.Errorf("%s: %v", source, err)
+		}
+	}
 	if err != nil {
 		log.Println(err)
 		exit.Log(`Use command "muk" to regenerate the model file.`)
 	}
 	return
 }
+
+// modelContent returns the model file content readModel would use.
+func modelContent(cl *commandLine) (content []byte, source string, err error) {
+	c, found := cl.locate(cl.dm, d2bin.Mfn, d2path.Data)
+	if !found && !cl.explicit(cl.dm) && embeddedModel != nil {
+		return embeddedModel, embeddedSource, nil
+	}
+	content, err = ioutil.ReadFile(c.Path)
+	return content, c.Path, err
+}
+
+// mjdDate formats an MJD as a calendar date.
+func mjdDate(mjd float64) string {
+	return time.Unix(int64((mjd-40587)*86400), 0).UTC().Format("2006-01-02")
+}
@@ -0,0 +1,10 @@
+// Public domain.
+
+//go:build !embed
+// +build !embed
+
+package d2prog
+
+// Without the embed build tag there are no default data files compiled
+// into the binary.
+var embeddedModel, embeddedObscodes []byte
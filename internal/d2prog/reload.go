@@ -0,0 +1,184 @@
+// Public domain.
+
+package d2prog
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"reflect"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/soniakeys/digest2/internal/d2bin"
+	"github.com/soniakeys/digest2/internal/d2path"
+	"github.com/soniakeys/digest2/internal/d2solver"
+	"github.com/soniakeys/mpcformat"
+	"github.com/soniakeys/observation"
+)
+
+// snapshot holds the model, obscodes, and configuration used for solving.
+// A snapshot is not modified once stored in current.  Reloading stores a new
+// one.  Arcs capture the current snapshot when dispatched so an arc is solved
+// entirely with one snapshot.
+type snapshot struct {
+	model  *d2bin.File
+	ocdMap observation.ParallaxMap
+	cf     *config
+	solver *d2solver.D2Solver
+	// fingerprints of file content
+	modelFP, ocdFP, configFP string
+}
+
+var current atomic.Value // *snapshot
+
+func currentSnapshot() *snapshot {
+	return current.Load().(*snapshot)
+}
+
+// fingerprint identifies file content b.  Nil content, as for a config file
+// that is not present, has fingerprint "none".
+func fingerprint(b []byte) string {
+	if b == nil {
+		return "none"
+	}
+	s := sha256.Sum256(b)
+	return hex.EncodeToString(s[:6])
+}
+
+// watchReload reloads the model, obscodes, and config file on SIGHUP and,
+// if interval is not zero, when one of the files changes.  It does not
+// return.
+func watchReload(cl *commandLine, interval time.Duration) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	var tick <-chan time.Time
+	if interval > 0 {
+		tick = time.NewTicker(interval).C
+	}
+	last := fileStamps(cl)
+	for {
+		select {
+		case <-hup:
+			log.Print("SIGHUP, reloading")
+		case <-tick:
+			s := fileStamps(cl)
+			if s == last {
+				continue
+			}
+			last = s
+			log.Print("file change, reloading")
+		}
+		cur := currentSnapshot()
+		next, err := reload(cl, cur)
+		switch {
+		case err != nil:
+			log.Print("reload refused: ", err)
+		case next == cur:
+			log.Print("reload: no changes")
+		default:
+			current.Store(next)
+			log.Printf("reload: model %s -> %s, obscodes %s -> %s, "+
+				"config %s -> %s", cur.modelFP, next.modelFP,
+				cur.ocdFP, next.ocdFP, cur.configFP, next.configFP)
+		}
+	}
+}
+
+// fileStamps describes the modification times and sizes of the files
+// reload would read.
+func fileStamps(cl *commandLine) string {
+	var s string
+	for _, f := range []struct {
+		spec, fn string
+		k        d2path.Kind
+	}{
+		{cl.dm, d2bin.Mfn, d2path.Data},
+		{cl.do, ocdFn, d2path.Data},
+		{cl.dc, configFn, d2path.Config},
+	} {
+		c, _ := cl.locate(f.spec, f.fn, f.k)
+		s += c.Path
+		if fi, err := os.Stat(c.Path); err == nil {
+			s += fmt.Sprint(" ", fi.ModTime().UnixNano(), " ", fi.Size())
+		}
+		s += "\n"
+	}
+	return s
+}
+
+// reload reads the model, obscodes, and config file and returns a new
+// snapshot, or cur if nothing changed.
+//
+// The new model must have the same partitions as the current one, and
+// the config file may change only obserr settings.  Other changes would
+// change the output columns and require a restart.
+func reload(cl *commandLine, cur *snapshot) (*snapshot, error) {
+	next := *cur
+	mb, _, err := modelContent(cl)
+	if err != nil {
+		return nil, err
+	}
+	if next.modelFP = fingerprint(mb); next.modelFP != cur.modelFP {
+		m, p, err := d2bin.Decode(bytes.NewReader(mb))
+		if err != nil {
+			return nil, err
+		}
+		if !p.Equal(d2bin.CurrentPartitions()) {
+			return nil, errors.New("model partitions differ")
+		}
+		if !reflect.DeepEqual(m.Classes, d2bin.ClassAbbrs()) ||
+			!reflect.DeepEqual(m.ClassDefs, d2bin.ClassDefs()) {
+			return nil, errors.New("model classes differ")
+		}
+		next.model = m
+	}
+	ob, err := ocdContent(cl)
+	if err != nil {
+		return nil, err
+	}
+	if next.ocdFP = fingerprint(ob); next.ocdFP != cur.ocdFP {
+		if next.ocdMap, err = mpcformat.ReadObscodeDat(
+			bytes.NewReader(ob)); err != nil {
+			return nil, err
+		}
+	}
+	cb, err := configContent(cl)
+	if err != nil {
+		return nil, err
+	}
+	next.configFP = fingerprint(cb)
+	if next.modelFP == cur.modelFP && next.ocdFP == cur.ocdFP &&
+		next.configFP == cur.configFP {
+		return cur, nil
+	}
+	// the config is parsed even if unchanged, as noid model names and
+	// obserr obscodes are validated against the model and obscodes.
+	if next.cf, err = parseConfig(cb, next.ocdMap,
+		&next.model.Header); err != nil {
+		return nil, err
+	}
+	if !sameLayout(cur.cf, next.cf) {
+		return nil, errors.New("config changes other than obserr " +
+			"or model changes to noid models require a restart")
+	}
+	next.solver = newSolver(next.model, next.cf)
+	return &next, nil
+}
+
+// sameLayout is true if a and b compute the same classes and produce the
+// same output columns.  NoID models are compared by name, as indexes can
+// differ between models.
+func sameLayout(a, b *config) bool {
+	oa, ob := *a.opt, *b.opt
+	oa.noidModels, ob.noidModels = nil, nil
+	return a.repeatable == b.repeatable &&
+		reflect.DeepEqual(a.classCompute, b.classCompute) &&
+		reflect.DeepEqual(oa, ob)
+}
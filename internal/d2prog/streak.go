@@ -0,0 +1,125 @@
+// Public domain.
+
+package d2prog
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"log"
+	"strconv"
+	"strings"
+
+	"github.com/soniakeys/digest2/internal/d2solver"
+	"github.com/soniakeys/mpcformat"
+	"github.com/soniakeys/observation"
+	"github.com/soniakeys/unit"
+)
+
+// obsKey identifies an observation by designation and time.
+type obsKey struct {
+	desig string
+	mjd   float64
+}
+
+// motionReader passes an observation stream through, removing motion lines
+// and keeping the motions by the observation they follow.
+//
+// A motion line follows the observation line of a streak, with the same
+// designation in columns 1-12 and 'm' in column 15.  Columns 16-77 hold,
+// separated by white space, the rate of motion in arc seconds per minute,
+// the position angle of motion in degrees east of north, and optionally
+// the uncertainties of the rate and position angle in the same units.
+// Trailing blanks and carriage returns are ignored.  Malformed motion lines
+// are logged and dropped.
+type motionReader struct {
+	sc     *bufio.Scanner
+	buf    []byte // remaining bytes of the line being read
+	last   string // last observation line passed
+	motion map[obsKey]*d2solver.Streak
+}
+
+func newMotionReader(r io.Reader) *motionReader {
+	return &motionReader{
+		sc:     bufio.NewScanner(r),
+		motion: map[obsKey]*d2solver.Streak{},
+	}
+}
+
+func (r *motionReader) Read(p []byte) (int, error) {
+	for len(r.buf) == 0 {
+		if !r.sc.Scan() {
+			if err := r.sc.Err(); err != nil {
+				return 0, err
+			}
+			return 0, io.EOF
+		}
+		l := strings.TrimRight(r.sc.Text(), "\r")
+		if m := strings.TrimRight(l, " "); len(m) > 14 && len(m) <= 80 &&
+			m[14] == 'm' {
+			if err := r.parseMotion(m); err != nil {
+				log.Printf("%v: %s", err, m)
+			}
+			continue
+		}
+		r.last = l
+		r.buf = append(r.buf[:0], l...)
+		r.buf = append(r.buf, '\n')
+	}
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+	return n, nil
+}
+
+// parseMotion parses motion line l, with trailing blanks removed.  It
+// returns an error if the line is invalid or does not follow an observation
+// line of the same designation.
+func (r *motionReader) parseMotion(l string) error {
+	if len(r.last) != 80 || r.last[:12] != l[:12] {
+		return errors.New("motion line does not follow its observation")
+	}
+	mjd, ok := mpcformat.ParseObs80Date(r.last[15:32])
+	if !ok {
+		return errors.New("motion line follows observation with invalid date")
+	}
+	if len(l) > 77 {
+		l = l[:77]
+	}
+	f := strings.Fields(l[15:])
+	if len(f) != 2 && len(f) != 4 {
+		return errors.New("motion line needs rate and position angle, " +
+			"and optionally their uncertainties")
+	}
+	var v [4]float64
+	for i, s := range f {
+		var err error
+		if v[i], err = strconv.ParseFloat(s, 64); err != nil || v[i] < 0 {
+			return errors.New("invalid motion value " + s)
+		}
+	}
+	r.motion[obsKey{strings.TrimSpace(l[:12]), mjd}] = &d2solver.Streak{
+		Rate:    unit.AngleFromSec(v[0] * 1440),
+		PA:      unit.AngleFromDeg(v[1]),
+		RateErr: unit.AngleFromSec(v[2] * 1440),
+		PAErr:   unit.AngleFromDeg(v[3]),
+	}
+	return nil
+}
+
+// streaks replaces the observation of an arc of a single observation with
+// a Streak if a motion line followed it.  Motions of other observations of
+// the arc are discarded.
+func (r *motionReader) streaks(a *observation.Arc) {
+	for i, o := range a.Obs {
+		k := obsKey{a.Desig, o.Meas().MJD}
+		s, ok := r.motion[k]
+		if !ok {
+			continue
+		}
+		delete(r.motion, k)
+		if len(a.Obs) == 1 {
+			s.VObs = o
+			a.Obs[i] = s
+		}
+	}
+}
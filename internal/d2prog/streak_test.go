@@ -0,0 +1,74 @@
+// Public domain.
+
+package d2prog
+
+import (
+	"bytes"
+	"io/ioutil"
+	"log"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/soniakeys/mpcformat"
+	"github.com/soniakeys/unit"
+)
+
+const (
+	streakObs = "     K26A00X  C2026 01 05.31250 10 15 22.41 +12 31 05.2" +
+		"          19.8 V      F51"
+	streakMotion = "     K26A00X  m 12.52 243.7 .25 1.5" +
+		"                                          F51"
+)
+
+func TestMotionReader(t *testing.T) {
+	var logged bytes.Buffer
+	log.SetOutput(&logged)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+	mjd, _ := mpcformat.ParseObs80Date(streakObs[15:32])
+	key := obsKey{"K26A00X", mjd}
+	for _, tc := range []struct {
+		name, in string
+		ok       bool // motion kept
+	}{
+		{"valid", streakObs + "\n" + streakMotion + "\n", true},
+		{"crlf", streakObs + "\r\n" + streakMotion + "\r\n", true},
+		{"trailing blanks trimmed", streakObs + "\n" +
+			strings.TrimRight(streakMotion[:77], " ") + "\n", true},
+		{"bad rate", streakObs + "\n" +
+			strings.Replace(streakMotion, "12.52", "-12.5", 1) + "\n", false},
+		{"no observation", streakMotion + "\n", false},
+	} {
+		logged.Reset()
+		r := newMotionReader(strings.NewReader(tc.in))
+		out, err := ioutil.ReadAll(r)
+		if err != nil {
+			t.Fatal(tc.name, err)
+		}
+		if strings.Contains(string(out), " m ") {
+			t.Errorf("%s: motion line passed through", tc.name)
+		}
+		s, ok := r.motion[key]
+		if ok != tc.ok {
+			t.Errorf("%s: motion kept = %t, want %t", tc.name, ok, tc.ok)
+		}
+		if !tc.ok {
+			if logged.Len() == 0 {
+				t.Errorf("%s: malformed motion line not logged", tc.name)
+			}
+			continue
+		}
+		if logged.Len() > 0 {
+			t.Errorf("%s: logged %q", tc.name, logged.String())
+		}
+		if string(out) != streakObs+"\n" {
+			t.Errorf("%s: observation passed as %q", tc.name, out)
+		}
+		if s.Rate != unit.AngleFromSec(12.52*1440) ||
+			s.PA != unit.AngleFromDeg(243.7) ||
+			s.RateErr != unit.AngleFromSec(.25*1440) ||
+			s.PAErr != unit.AngleFromDeg(1.5) {
+			t.Errorf("%s: motion %+v", tc.name, *s)
+		}
+	}
+}
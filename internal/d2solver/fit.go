@@ -0,0 +1,158 @@
+// Public domain.
+
+package d2solver
+
+import (
+	"math"
+
+	"github.com/soniakeys/astro"
+	"github.com/soniakeys/coord"
+	"github.com/soniakeys/observation"
+)
+
+// fitErrFactor is the residual allowed in fitting orbits to observations,
+// in observational errors.
+const fitErrFactor = 3
+
+// fitObs is an observation prepared for testing orbits against.  Vectors
+// are ecliptic.
+type fitObs struct {
+	mjd           float64
+	sunObserver   coord.Cart
+	earthObserver coord.Cart
+	u             coord.Cart // observer-object unit vector
+	allow         float64    // residual allowed, radians
+}
+
+// prepObs prepares observations vobs for testing orbits against.  The
+// allowance is from the observational error specified for each.
+func (a *arc) prepObs(vobs []observation.VObs) []fitObs {
+	obs := make([]fitObs, len(vobs))
+	for i, o := range vobs {
+		g := &obs[i]
+		m := o.Meas()
+		g.mjd = m.MJD
+		g.sunObserver = a.sov(o) // also sets a.soe, a.coe
+		g.earthObserver = a.eov(o)
+		g.u = a.oouv(m, 0, 0, 0)
+		g.allow = fitErrFactor * a.solver.clipErr(0, m.Qual).Rad()
+	}
+	return obs
+}
+
+// eov returns the earth-observer vector of o in ecliptic coordinates.
+func (a *arc) eov(o interface{ EarthObserverVect() coord.Cart }) coord.Cart {
+	eo := o.EarthObserverVect()
+	eo.RotateX(&eo, a.soe, a.coe)
+	return eo
+}
+
+// residual solves the two-body orbit from r0 at the time of a.first to r1
+// at the time of a.last and returns the largest residual of obs, relative
+// to the allowance.  The orbit is geocentric if geo is true, heliocentric
+// otherwise.
+func (a *arc) residual(obs []fitObs, r0, r1 *coord.Cart, mu float64,
+	geo bool) (res float64) {
+	v, ok := shoot(r0, r1, mu, a.dt)
+	if !ok {
+		return math.Inf(1)
+	}
+	t0 := a.first.Meas().MJD
+	for i := range obs {
+		g := &obs[i]
+		p := propagate(r0, &v, mu, g.mjd-t0)
+		if geo {
+			p.Sub(&p, &g.earthObserver)
+		} else {
+			p.Sub(&p, &g.sunObserver)
+		}
+		var x coord.Cart
+		x.Cross(&p, &g.u)
+		// sine of the residual
+		r := math.Sqrt(x.Square()/p.Square()) / g.allow
+		if math.IsNaN(r) {
+			return math.Inf(1)
+		}
+		res = math.Max(res, r)
+	}
+	return
+}
+
+// fitSamples is the number of angles tagged at each distance by searchFit.
+const fitSamples = 20
+
+// searchFit searches orbits that fit all observations of the arc.
+//
+// Orbits consistent with the curvature of an arc can occupy a region of
+// distance and angle too small for the search by dRange and aRange to find.
+// searchFit samples distances spaced logarithmically as geo does, refining
+// minima of the residual between samples, and at each distance where an
+// orbit fits tags orbits across the range of angles that fit.
+func (a *arc) searchFit() {
+	a.offsetMotionVector(0, 0)
+	lo, hi := math.Log10(min_distance), math.Log10(max_distance)
+	n := int((hi-lo)*geoPerDecade + .5)
+	res := make([]float64, n)
+	for k := range res {
+		res[k], _, _ = a.geoFit(a.fit, lo+(float64(k)+.5)/geoPerDecade)
+	}
+	for k, r := range res {
+		ld := lo + (float64(k)+.5)/geoPerDecade
+		if !(r <= 1) && (k == 0 || res[k-1] > r) && (k == n-1 || res[k+1] > r) {
+			// local minimum, refine between neighboring samples
+			ld, r = goldenMin(func(ld float64) float64 {
+				r, _, _ := a.geoFit(a.fit, ld)
+				return r
+			}, math.Max(lo, ld-1./geoPerDecade), math.Min(hi, ld+1./geoPerDecade))
+		}
+		if r <= 1 {
+			a.fitDistance(ld)
+		}
+	}
+}
+
+// fitDistance tags orbits at the distance with log ld, at angles spanning
+// the range where orbits fit all observations of the arc.
+func (a *arc) fitDistance(ld float64) {
+	// geoFit leaves the distance dependent vectors solved for ld
+	r, best, _ := a.geoFit(a.fit, ld)
+	if !(r <= 1) {
+		return
+	}
+	ang1, ang2, _ := a.solveAngleRange(0)
+	an1 := fitEdge(a.angleResidual, best, ang1)
+	an2 := fitEdge(a.angleResidual, best, ang2)
+	a.clearDTags()
+	step := (an2 - an1) / fitSamples
+	for x := 0; x < fitSamples; x++ {
+		a.tagAngle(an1 + (float64(x)+.5)*step)
+	}
+	a.collectTags()
+}
+
+// angleResidual returns the residual, relative to the allowance, of the
+// heliocentric orbit at angle an at the current distance.
+func (a *arc) angleResidual(an float64) float64 {
+	a.velocity(an)
+	var r1 coord.Cart
+	r1.MulScalar(&a.v, a.dt*astro.K)
+	r1.Add(&r1, &a.sunObject0)
+	return a.residual(a.fit, &a.sunObject0, &r1, astro.U, false)
+}
+
+// fitEdge returns the edge of the range where f fits, between in, where
+// it does, and out, by bisection.
+func fitEdge(f func(float64) float64, in, out float64) float64 {
+	if f(out) <= 1 {
+		return out
+	}
+	for i := 0; i < 40; i++ {
+		m := (in + out) / 2
+		if f(m) <= 1 {
+			in = m
+		} else {
+			out = m
+		}
+	}
+	return in
+}
@@ -0,0 +1,59 @@
+// Public domain.
+
+package d2solver
+
+import (
+	"math"
+	"testing"
+
+	"github.com/soniakeys/unit"
+	xrand "golang.org/x/exp/rand"
+)
+
+// Pruning keeps the orbit of a three night arc and prunes orbits that do not
+// fit it, counting both.
+func TestPrune(t *testing.T) {
+	s := testSolver(t, unit.AngleFromSec(1))
+	rnd := xrand.New(&xrand.PCGSource{})
+	tk := mainBelt(site, testMJD, testMJD+.04, testMJD+1, testMJD+3)
+	if _, _, ind := s.Solve(tk, 20, rnd); ind.Samples != 0 || ind.Pruned != 0 {
+		t.Fatal("pruned when not selected:", ind)
+	}
+	s.Curvature = true
+	a := s.newArc(tk, 20, rnd)
+	a.score()
+	if a.ind.Samples == 0 || a.ind.Pruned == 0 ||
+		a.ind.Pruned >= a.ind.Samples {
+		t.Fatal("search", a.ind)
+	}
+
+	// at the distance of the object, the best fitting angle gives its orbit
+	r := mainBeltOrbit()(a.first.Meas().MJD)
+	so := a.sov(a.first)
+	r.Sub(&r, &so)
+	a.offsetMotionVector(0, 0)
+	a.solveDistanceDependentVectors(math.Sqrt(r.Square()))
+	ang1, ang2, ok := a.solveAngleRange(0)
+	if !ok {
+		t.Fatal("no orbits at the distance of the object")
+	}
+	best, res := goldenMin(a.angleResidual, ang1, ang2)
+	a.velocity(best)
+	if q, e, _, _ := a.qei(); res > 1 || math.Abs(q-2.5) > .05 || e > .05 {
+		t.Fatal("best fit q, e =", q, e, "residual", res)
+	}
+	a.ind = Indicators{}
+	a.tagAngle(best)
+	if a.ind != (Indicators{Samples: 1}) {
+		t.Fatal("orbit of the object pruned:", a.ind)
+	}
+	// an orbit at the same distance not fitting the later nights
+	an := (best + ang2) / 2
+	if !(a.angleResidual(an) > 1) {
+		t.Fatal("orbit at angle", an, "fits")
+	}
+	a.tagAngle(an)
+	if a.ind != (Indicators{Samples: 2, Pruned: 1}) {
+		t.Fatal("inconsistent orbit not pruned:", a.ind)
+	}
+}
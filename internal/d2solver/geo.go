@@ -0,0 +1,211 @@
+// Public domain.
+
+package d2solver
+
+import (
+	"math"
+
+	"github.com/soniakeys/astro"
+	"github.com/soniakeys/coord"
+	"github.com/soniakeys/observation"
+)
+
+// parameters for the search for geocentric orbits
+const (
+	hillRadius     = .01                 // AU, of the Earth
+	earthRadius    = 4.2635e-5           // AU
+	muEarth        = astro.U / 332946.05 // AU^3/day^2
+	geoMinDistance = 1e-5                // AU, about 1500 km
+	geoPerDecade   = 10                  // distances sampled per decade
+	geoSamples     = 50                  // orbits sampled at each distance
+	// largest geocentric velocity sampled, 50 km/s in AU/day
+	geoVMax = 50 / 1731.456837
+)
+
+// geo sets the indicator Geo.
+//
+// It uses the first and last observations as endpoints of the motion
+// vector, as endpoints synthesized from a great circle fit do not show
+// parallax.  It replaces those of the arc and so must follow other searches.
+// For a Streak the synthesized endpoints are all there is to fit.
+//
+// It samples distances spaced logarithmically from geoMinDistance to
+// max_distance and fits orbits at each distance to all observations of the
+// arc.  Within the Hill sphere orbits are geocentric, beyond it they are
+// heliocentric.  Orbits are two-body, from the topocentric endpoints of the
+// motion vector, and are propagated to the time of each observation as seen
+// from its site.  Close to the Earth the parallax of the site then rules out
+// distances where the observations do not show it, and confines the
+// distance where they do to a narrow range.  Minima of the residual between
+// sampled distances are refined so these are found.
+//
+// A sampled distance is consistent if an orbit there or at a refined
+// minimum nearby fits all observations within fitErrFactor times the
+// observational error.  Geo is the percentage of consistent distances where
+// the best fitting orbit is geocentrically bound.
+func (a *arc) geo() {
+	vobs := a.obs.Obs
+	if len(vobs) == 1 {
+		vobs = []observation.VObs{a.first, a.last}
+	}
+	obs := a.prepObs(vobs)
+	a.first = vobs[0]
+	a.last = vobs[len(vobs)-1]
+	a.dt = a.last.Meas().MJD - a.first.Meas().MJD
+	a.invdt = 1 / a.dt
+	a.invdtsq = a.invdt * a.invdt
+	a.sunObserver0 = obs[0].sunObserver
+	a.sunObserver1 = obs[len(obs)-1].sunObserver
+	a.offsetMotionVector(0, 0)
+
+	// residuals at sampled distances, by log distance
+	lo, hi := math.Log10(geoMinDistance), math.Log10(max_distance)
+	n := int((hi-lo)*geoPerDecade + .5)
+	res := make([]float64, n)
+	bound := make([]bool, n)
+	for k := range res {
+		res[k], _, bound[k] = a.geoFit(obs, lo+(float64(k)+.5)/geoPerDecade)
+	}
+	var nFit, nBound int
+	for k, r := range res {
+		if !(r <= 1) && (k == 0 || res[k-1] > r) && (k == n-1 || res[k+1] > r) {
+			// local minimum, refine between neighboring samples.  the
+			// boundness is that of the best orbit the refinement found.
+			ld := lo + (float64(k)+.5)/geoPerDecade
+			rMin, b := r, bound[k]
+			goldenMin(func(ld float64) float64 {
+				r, _, bd := a.geoFit(obs, ld)
+				if r < rMin {
+					rMin, b = r, bd
+				}
+				return r
+			}, math.Max(lo, ld-1./geoPerDecade), math.Min(hi, ld+1./geoPerDecade))
+			r, bound[k] = rMin, b
+		}
+		if r <= 1 {
+			nFit++
+			if bound[k] {
+				nBound++
+			}
+		}
+	}
+	if nFit > 0 {
+		a.ind.Geo = 100 * float64(nBound) / float64(nFit)
+	}
+}
+
+// geoFit fits orbits at the distance with log ld at the time of a.first.
+// It returns the smallest residual, relative to the allowance, the sample
+// of the best fitting orbit, and whether that orbit is geocentrically bound.
+//
+// Orbits are sampled by the distance at the time of a.last for geocentric
+// orbits and by angle as for tagAngle for heliocentric orbits.  The best
+// sample is refined.
+func (a *arc) geoFit(obs []fitObs, ld float64) (res, best float64,
+	bound bool) {
+	d := math.Pow(10, ld)
+	var r0 coord.Cart
+	var s1, s2, mu float64
+	var observer *coord.Cart
+	var geo, ok bool
+	if d < hillRadius {
+		r0.MulScalar(&a.observerObjectUnit0, d)
+		eo := a.eov(a.first)
+		r0.Add(&r0, &eo)
+		if r0.Square() < earthRadius*earthRadius {
+			return math.Inf(1), 0, false
+		}
+		geo, mu = true, muEarth
+		observer = &obs[len(obs)-1].earthObserver
+		if s1, s2, ok = a.geoRange(&r0, observer, geoVMax); !ok {
+			return math.Inf(1), 0, false
+		}
+	} else {
+		a.solveDistanceDependentVectors(d)
+		if s1, s2, ok = a.solveAngleRange(0); !ok {
+			return math.Inf(1), 0, false
+		}
+		r0, mu = a.sunObject0, astro.U
+	}
+	// r1 returns the position at the time of a.last for sample s
+	r1 := func(s float64) (r coord.Cart) {
+		if geo {
+			r.MulScalar(&a.observerObjectUnit1, s)
+			r.Add(&r, observer)
+			return
+		}
+		a.velocity(s)
+		r.MulScalar(&a.v, a.dt*astro.K)
+		r.Add(&r, &r0)
+		return
+	}
+	f := func(s float64) float64 {
+		p := r1(s)
+		return a.residual(obs, &r0, &p, mu, geo)
+	}
+	step := (s2 - s1) / geoSamples
+	res = math.Inf(1)
+	best = s1
+	for sx := 0; sx < geoSamples; sx++ {
+		s := s1 + (float64(sx)+.5)*step
+		if r := f(s); r < res {
+			res, best = r, s
+		}
+	}
+	if res > 1 {
+		if s, r := goldenMin(f, math.Max(s1, best-step),
+			math.Min(s2, best+step)); r < res {
+			res, best = r, s
+		}
+	}
+	if geo {
+		p := r1(best)
+		if v, ok := shoot(&r0, &p, mu, a.dt); ok {
+			bound = v.Square()/2 < mu/math.Sqrt(r0.Square())
+		}
+	}
+	return
+}
+
+// geoRange returns the range of distances s at the time of a.last for which
+// the geocentric chord velocity from r0 is at most vMax.
+func (a *arc) geoRange(r0, earthObserver1 *coord.Cart, vMax float64) (
+	s1, s2 float64, ok bool) {
+	// |s*u1 - w| <= vMax*dt, where w = r0 - earthObserver1
+	var w coord.Cart
+	w.Sub(r0, earthObserver1)
+	b := a.observerObjectUnit1.Dot(&w)
+	vdt := vMax * a.dt
+	dsc := b*b - w.Square() + vdt*vdt
+	if !(dsc > 0) {
+		return
+	}
+	sd := math.Sqrt(dsc)
+	if b+sd <= 0 {
+		return
+	}
+	return math.Max(0, b-sd), b + sd, true
+}
+
+// goldenMin returns the location and value of the minimum of f in the
+// interval a, b, by golden section search.
+func goldenMin(f func(float64) float64, a, b float64) (x, fx float64) {
+	const g = .6180339887498949 // 1/phi
+	c, d := b-g*(b-a), a+g*(b-a)
+	fc, fd := f(c), f(d)
+	for b-a > 1e-6*(math.Abs(a)+math.Abs(b)) {
+		if fc < fd {
+			b, d, fd = d, c, fc
+			c = b - g*(b-a)
+			fc = f(c)
+		} else {
+			a, c, fc = c, d, fd
+			d = a + g*(b-a)
+			fd = f(d)
+		}
+	}
+	if fc < fd {
+		return c, fc
+	}
+	return d, fd
+}
@@ -0,0 +1,54 @@
+// Public domain.
+
+package d2solver
+
+import (
+	"math"
+	"testing"
+
+	"github.com/soniakeys/coord"
+	"github.com/soniakeys/observation"
+	"github.com/soniakeys/unit"
+	xrand "golang.org/x/exp/rand"
+)
+
+// a mid latitude site
+var site = &observation.ParallaxConst{
+	Longitude: unit.AngleFromDeg(-110),
+	RhoCosPhi: .75 * earthRadius,
+	RhoSinPhi: .66 * earthRadius,
+}
+
+// satellite is a tracklet from site of a circular geocentric orbit of
+// radius 40000 km.
+func satellite(mjd ...float64) *observation.Arc {
+	r0 := coord.Cart{X: -2.67e-4}
+	v0 := coord.Cart{Y: -.9, Z: .4}
+	v0.MulScalar(&v0, math.Sqrt(muEarth/2.67e-4/v0.Square()))
+	return tracklet(site, func(mjd float64) coord.Cart {
+		r := propagate(&r0, &v0, muEarth, mjd-testMJD)
+		e := earth(mjd)
+		r.Add(&r, &e)
+		return r
+	}, mjd...)
+}
+
+// Geo flags a satellite and not a main belt object, and only when selected.
+func TestGeo(t *testing.T) {
+	s := testSolver(t, unit.AngleFromSec(1))
+	rnd := xrand.New(&xrand.PCGSource{})
+	times := []float64{testMJD, testMJD + .014, testMJD + .028, testMJD + .042}
+	sat := satellite(times...)
+	if _, _, ind := s.Solve(sat, 20, rnd); ind.Geo != 0 {
+		t.Fatal("geo searched when not selected:", ind)
+	}
+	s.Geo = true
+	_, _, ind := s.Solve(sat, 20, rnd)
+	_, _, mb := s.Solve(mainBelt(site, times...), 20, rnd)
+	if ind.Geo < 50 {
+		t.Fatal("satellite not flagged:", ind)
+	}
+	if mb.Geo > 10 {
+		t.Fatal("main belt flagged:", mb)
+	}
+}
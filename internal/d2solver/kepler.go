@@ -0,0 +1,110 @@
+// Public domain.
+
+package d2solver
+
+import (
+	"math"
+
+	"github.com/soniakeys/coord"
+)
+
+// propagate returns the position at time t after the two-body state r0, v0,
+// about a body with gravitational parameter mu.  Units are AU and days.
+//
+// It uses the universal variable formulation, valid for all types of orbit.
+// t may be negative.
+func propagate(r0, v0 *coord.Cart, mu, t float64) (r coord.Cart) {
+	r0m := math.Sqrt(r0.Square())
+	smu := math.Sqrt(mu)
+	vr0 := r0.Dot(v0) / r0m
+	alpha := 2/r0m - v0.Square()/mu // reciprocal of semimajor axis
+	// solve the universal Kepler equation for x by Newton's method
+	x := smu * math.Abs(alpha) * t
+	if alpha <= 0 || x == 0 {
+		x = smu * t / r0m
+	}
+	for it := 0; it < 50; it++ {
+		z := alpha * x * x
+		c, s := stumpff(z)
+		f := r0m*vr0/smu*x*x*c + (1-alpha*r0m)*x*x*x*s + r0m*x - smu*t
+		df := r0m*vr0/smu*x*(1-z*s) + (1-alpha*r0m)*x*x*c + r0m
+		dx := f / df
+		x -= dx
+		if math.Abs(dx) <= 1e-12*math.Max(1, math.Abs(x)) {
+			break
+		}
+	}
+	z := alpha * x * x
+	c, s := stumpff(z)
+	f := 1 - x*x/r0m*c
+	g := t - x*x*x*s/smu
+	r.X = f*r0.X + g*v0.X
+	r.Y = f*r0.Y + g*v0.Y
+	r.Z = f*r0.Z + g*v0.Z
+	return
+}
+
+// stumpff returns the Stumpff functions C(z) and S(z).
+func stumpff(z float64) (c, s float64) {
+	switch {
+	case math.Abs(z) < 1e-3:
+		// series, avoiding loss of precision near 0
+		return 1./2 - z/24 + z*z/720, 1./6 - z/120 + z*z/5040
+	case z > 0:
+		sz := math.Sqrt(z)
+		return (1 - math.Cos(sz)) / z, (sz - math.Sin(sz)) / (z * sz)
+	}
+	sz := math.Sqrt(-z)
+	return (math.Cosh(sz) - 1) / -z, (math.Sinh(sz) - sz) / (-z * sz)
+}
+
+// shoot returns the velocity at r0 of a two-body orbit about a body with
+// gravitational parameter mu that reaches r1 after time t.
+//
+// It starts from the chord velocity and corrects it by Newton's method with
+// a numerical Jacobian.  This converges for t up to a good part of the
+// orbital period.  ok is false if it does not converge.
+func shoot(r0, r1 *coord.Cart, mu, t float64) (v coord.Cart, ok bool) {
+	v.Sub(r1, r0)
+	v.MulScalar(&v, 1/t)
+	tol := 1e-10 * math.Sqrt(r1.Square())
+	for it := 0; it < 10; it++ {
+		p := propagate(r0, &v, mu, t)
+		var miss coord.Cart
+		miss.Sub(r1, &p)
+		if math.Sqrt(miss.Square()) < tol {
+			return v, true
+		}
+		// columns of the Jacobian of position with respect to velocity
+		h := 1e-7 * math.Sqrt(v.Square())
+		var j [3]coord.Cart
+		for k := range j {
+			dv := v
+			switch k {
+			case 0:
+				dv.X += h
+			case 1:
+				dv.Y += h
+			default:
+				dv.Z += h
+			}
+			j[k] = propagate(r0, &dv, mu, t)
+			j[k].Sub(&j[k], &p)
+			j[k].MulScalar(&j[k], 1/h)
+		}
+		// solve for the correction by Cramer's rule
+		var c coord.Cart
+		c.Cross(&j[1], &j[2])
+		det := j[0].Dot(&c)
+		if det == 0 {
+			return
+		}
+		var c2, c3 coord.Cart
+		c2.Cross(&j[2], &j[0])
+		c3.Cross(&j[0], &j[1])
+		v.X += miss.Dot(&c) / det
+		v.Y += miss.Dot(&c2) / det
+		v.Z += miss.Dot(&c3) / det
+	}
+	return
+}
@@ -0,0 +1,60 @@
+// Public domain.
+
+package d2solver
+
+import (
+	"math"
+	"testing"
+
+	"github.com/soniakeys/astro"
+	"github.com/soniakeys/coord"
+)
+
+// propagate then shoot back recovers the initial velocity.
+func TestPropagateShoot(t *testing.T) {
+	rGeo := 2.67e-4 // AU, about 40000 km
+	vGeo := math.Sqrt(muEarth / rGeo)
+	for _, tc := range []struct {
+		name   string
+		r0, v0 coord.Cart
+		mu, t  float64
+		want   *coord.Cart // expected position, if known
+	}{
+		// quarter of a circular orbit
+		{"circular", coord.Cart{X: 1}, coord.Cart{Y: astro.K},
+			astro.U, math.Pi / 2 / astro.K, &coord.Cart{Y: 1}},
+		{"circular backward", coord.Cart{X: 1}, coord.Cart{Y: astro.K},
+			astro.U, -math.Pi / 2 / astro.K, &coord.Cart{Y: -1}},
+		{"elliptic", coord.Cart{X: 1}, coord.Cart{Y: 1.2 * astro.K,
+			Z: .3 * astro.K}, astro.U, 100, nil},
+		// e = 3
+		{"hyperbolic", coord.Cart{X: 1}, coord.Cart{Y: 2 * astro.K},
+			astro.U, 30, nil},
+		{"parabolic", coord.Cart{X: 1}, coord.Cart{Y: math.Sqrt2 * astro.K},
+			astro.U, 30, nil},
+		{"geocentric", coord.Cart{X: rGeo}, coord.Cart{Y: vGeo},
+			muEarth, math.Pi / 2 * rGeo / vGeo, &coord.Cart{Y: rGeo}},
+		{"geocentric hyperbolic", coord.Cart{X: rGeo},
+			coord.Cart{Y: 2 * vGeo, Z: vGeo}, muEarth, .1, nil},
+	} {
+		r := propagate(&tc.r0, &tc.v0, tc.mu, tc.t)
+		scale := math.Sqrt(tc.r0.Square())
+		if tc.want != nil {
+			var d coord.Cart
+			d.Sub(&r, tc.want)
+			if math.Sqrt(d.Square()) > 1e-9*scale {
+				t.Errorf("%s: propagate = %+v, want %+v", tc.name, r, *tc.want)
+			}
+		}
+		v, ok := shoot(&tc.r0, &r, tc.mu, tc.t)
+		if !ok {
+			t.Errorf("%s: shoot did not converge", tc.name)
+			continue
+		}
+		var d coord.Cart
+		d.Sub(&v, &tc.v0)
+		if math.Sqrt(d.Square()) > 1e-7*math.Sqrt(tc.v0.Square()) {
+			t.Errorf("%s: shoot = %+v, want %+v", tc.name, v, tc.v0)
+		}
+	}
+}
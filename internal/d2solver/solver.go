@@ -20,33 +20,90 @@ import (
 // which orbit classes to compute scores for, and standard observational
 // errors to apply to observations.
 type D2Solver struct {
-	all, unk      d2bin.Model
+	all           d2bin.Model
+	unk           []d2bin.Model
+	unkGroups     []d2bin.UnkGroup
 	classCompute  []int // from config file
 	obsErrMap     map[string]unit.Angle
 	obsErrDefault unit.Angle
+
+	// Curvature selects pruning of orbits that do not fit all observations
+	// of an arc, as described for Indicators.  It is false as returned by
+	// New.
+	Curvature bool
+
+	// Unbound selects sampling of unbound orbits for the indicators Unbound
+	// and Far.  It is false as returned by New, leaving both zero.
+	Unbound bool
+
+	// Geo selects the search for geocentric orbits for the indicator Geo.
+	// It is false as returned by New, leaving Geo zero.
+	Geo bool
 }
 
 // New creates a D2Solver object from passed parameters.
-func New(all, unk d2bin.Model, classCompute []int,
+//
+// A NoId score is computed for each group of unknown models in m.
+// For groups of epoch specific models, the populations are interpolated
+// to the date of the arc.
+func New(m *d2bin.File, classCompute []int,
 	obsErrMap map[string]unit.Angle, obsErrDefault unit.Angle) *D2Solver {
-	return &D2Solver{all, unk, classCompute, obsErrMap, obsErrDefault}
+	return &D2Solver{all: m.All, unk: m.Unk, unkGroups: m.UnkGroups(),
+		classCompute: classCompute, obsErrMap: obsErrMap,
+		obsErrDefault: obsErrDefault}
 }
 
 // Solve runs the digest2 algorithm on a single observational arc.
 //
+// The arc must have at least two observations with increasing times, or
+// a single Streak.
+//
 // Rms returned is based on residuals of all observations in the arc
 // against fitted linear great circle motion.
 // Digest2 scores are returned in the slice classScores.
+// Indicators independent of the population model are returned in ind.
 func (s *D2Solver) Solve(obs *observation.Arc, vMag float64,
-	rnd *xrand.Rand) (rms unit.Angle, classScores []Scores) {
+	rnd *xrand.Rand) (rms unit.Angle, classScores []Scores, ind Indicators) {
 	a := s.newArc(obs, vMag, rnd) // create workspace
 	a.score()                     // run the algorithm
-	return a.rms, a.classScores
+	return a.rms, a.classScores, a.ind
+}
+
+// Tags runs the digest2 algorithm on a single observational arc and returns
+// the set of model bins tagged by the orbit search, by flat model index.
+func (s *D2Solver) Tags(obs *observation.Arc, vMag float64,
+	rnd *xrand.Rand) map[int]bool {
+	a := s.newArc(obs, vMag, rnd)
+	a.tags = make(map[int]bool)
+	a.score()
+	return a.tags
 }
 
 // Scores is the return type from D2Solver.Solve
+//
+// NoId has a score for each unknown model group.
 type Scores struct {
-	Raw, NoId float64
+	Raw  float64
+	NoId []float64
+}
+
+// Indicators are results of the orbit search that are independent of the
+// population model.
+//
+// Unbound and Far are percentages of orbits with e >= 1 and with e > 1.1,
+// beyond the model, sampled as described for unbound.  Geo is the
+// percentage of distances consistent with the observations where a
+// geocentrically bound orbit fits, as described for geo.
+//
+// Samples and Pruned count orbits of the search for scores when pruning
+// for curvature.  Each orbit within the model is propagated two-body to the
+// time of every observation of the arc and pruned if a residual exceeds
+// the allowance for observational error.  Pruning needs at least three
+// observations and non-zero observational error.  Otherwise both are 0.
+type Indicators struct {
+	Unbound, Far    float64
+	Geo             float64
+	Samples, Pruned int
 }
 
 // Big messy struct is the workspace for the digest2 algorithm.
@@ -62,6 +119,7 @@ type arc struct {
 	// result values read by digest2.solve
 	rms         unit.Angle // rms for arc as a whole
 	classScores []Scores
+	ind         Indicators
 
 	cs []*classStats
 
@@ -94,11 +152,15 @@ type arc struct {
 
 	dAnyTag bool
 	dTag    map[int]bool
+	tags    map[int]bool // all bins tagged, collected only if non-nil
+	fit     []fitObs     // observations for pruning, nil if not pruning
 
 	// angle dependent working variables.  recomputed many times.
 	// local variables would read more easily, but structs are here
 	// to reduce garbage
-	hv, v coord.Cart
+	hv, v, ev  coord.Cart
+	orb        d2bin.Orbit
+	anglesFunc func() (node, peri unit.Angle) // a.nodePeri
 }
 
 func (s *D2Solver) newArc(obs *observation.Arc, vMag float64,
@@ -113,12 +175,16 @@ func (s *D2Solver) newArc(obs *observation.Arc, vMag float64,
 		classScores: make([]Scores, len(s.classCompute)),
 		cs:          make([]*classStats, len(s.classCompute)),
 	}
+	a.anglesFunc = a.nodePeri
 	for c, _ := range a.cs {
 		a.cs[c] = &classStats{
-			dInClass:    make(map[int]bool),
-			dNonClass:   make(map[int]bool),
-			tagInClass:  make(map[int]bool),
-			tagNonClass: make(map[int]bool)}
+			dInClass:       make(map[int]bool),
+			dNonClass:      make(map[int]bool),
+			tagInClass:     make(map[int]bool),
+			tagNonClass:    make(map[int]bool),
+			sumUnkInClass:  make([]float64, len(s.unk)),
+			sumUnkNonClass: make([]float64, len(s.unk))}
+		a.classScores[c].NoId = make([]float64, len(s.unkGroups))
 	}
 	return a
 }
@@ -127,7 +193,7 @@ func (s *D2Solver) newArc(obs *observation.Arc, vMag float64,
 type classStats struct {
 	tagInClass, tagNonClass       map[int]bool
 	sumAllInClass, sumAllNonClass float64
-	sumUnkInClass, sumUnkNonClass float64
+	sumUnkInClass, sumUnkNonClass []float64 // per unknown model
 	dInClass, dNonClass           map[int]bool
 }
 
@@ -165,10 +231,29 @@ func (a *arc) score() {
 	if a.firstObsErr == 0 && a.lastObsErr == 0 {
 		a.noObsErr = true
 	}
+	if solver.Curvature && len(a.obs.Obs) > 2 && !a.noObsErr {
+		a.fit = a.prepObs(a.obs.Obs)
+	}
 
 	a.searchDistance(min_distance)
 	a.searchDistance(max_distance)
 	a.dRange(min_distance, max_distance, 0)
+	if a.fit != nil {
+		a.searchFit()
+	}
+	if solver.Unbound {
+		a.unbound()
+	}
+	if solver.Geo {
+		a.geo()
+	}
+
+	// weights for unknown models, by group, for the mean date of the arc
+	mjd := (m1.MJD + m2.MJD) / 2
+	weights := make([][]float64, len(solver.unkGroups))
+	for g := range solver.unkGroups {
+		weights[g] = solver.unkGroups[g].Weights(mjd)
+	}
 
 	var score float64
 	for i, s := range a.cs {
@@ -182,15 +267,22 @@ func (a *arc) score() {
 		}
 		a.classScores[i].Raw = score
 
-		switch d := s.sumUnkInClass + s.sumUnkNonClass; {
-		case d > 0:
-			score = 100 * s.sumUnkInClass / d
-		case solver.classCompute[i] < 2:
-			score = 100
-		default:
-			score = 0
+		for g, ug := range solver.unkGroups {
+			var inClass, nonClass float64
+			for x, u := range ug.Models {
+				inClass += weights[g][x] * s.sumUnkInClass[u]
+				nonClass += weights[g][x] * s.sumUnkNonClass[u]
+			}
+			switch d := inClass + nonClass; {
+			case d > 0:
+				score = 100 * inClass / d
+			case solver.classCompute[i] < 2:
+				score = 100
+			default:
+				score = 0
+			}
+			a.classScores[i].NoId[g] = score
 		}
-		a.classScores[i].NoId = score
 	}
 }
 
@@ -339,13 +431,18 @@ func (a *arc) dRange(d1, d2 float64, age int) {
 }
 
 func (a *arc) searchAngles() bool {
-	ang1, ang2, ok := a.solveAngleRange()
+	ang1, ang2, ok := a.solveAngleRange(0)
 	if !ok {
 		return false
 	}
 
 	a.aRange(ang1, ang2, 0)
+	return a.collectTags()
+}
 
+// collectTags adds bins tagged at the current distance to the class sums.
+// It returns true if some class was newly tagged for some bin.
+func (a *arc) collectTags() bool {
 	if !a.dAnyTag {
 		return false
 	}
@@ -354,21 +451,27 @@ func (a *arc) searchAngles() bool {
 
 	for i, dt := range a.dTag {
 		if dt {
+			if a.tags != nil {
+				a.tags[i] = true
+			}
 			for cx, c := range a.solver.classCompute {
 				s := a.cs[cx]
 				if s.dInClass[i] && !s.tagInClass[i] {
 					newTag = true
 					s.tagInClass[i] = true
 					s.sumAllInClass += a.solver.all.Class[c][i]
-					s.sumUnkInClass += a.solver.unk.Class[c][i]
+					for u, unk := range a.solver.unk {
+						s.sumUnkInClass[u] += unk.Class[c][i]
+					}
 				}
 				if s.dNonClass[i] && !s.tagNonClass[i] {
 					newTag = true
 					s.tagNonClass[i] = true
 					s.sumAllNonClass +=
 						a.solver.all.SS[i] - a.solver.all.Class[c][i]
-					s.sumUnkNonClass +=
-						a.solver.unk.SS[i] - a.solver.unk.Class[c][i]
+					for u, unk := range a.solver.unk {
+						s.sumUnkNonClass[u] += unk.SS[i] - unk.Class[c][i]
+					}
 				}
 			}
 		}
@@ -377,7 +480,11 @@ func (a *arc) searchAngles() bool {
 }
 
 // parabolic limits
-func (a *arc) solveAngleRange() (ang1, ang2 float64, ok bool) {
+//
+// vInfSq extends the limits to hyperbolic orbits with the square of
+// hyperbolic excess velocity up to vInfSq, in AU/day.  It is 0 for the
+// parabolic limits.
+func (a *arc) solveAngleRange(vInfSq float64) (ang1, ang2 float64, ok bool) {
 	// solve angle range at this distance
 	th := a.observer1Object0.Dot(&a.observerObjectUnit1) /
 		a.observer1Object0Mag
@@ -386,7 +493,7 @@ func (a *arc) solveAngleRange() (ang1, ang2 float64, ok bool) {
 
 	aa := a.invdtsq
 	bb := -2 * a.observer1Object0Mag * th * aa
-	cc := a.observer1Object0MagSq*aa - 2*astro.U/a.sunObject0Mag
+	cc := a.observer1Object0MagSq*aa - 2*astro.U/a.sunObject0Mag - vInfSq
 	dsc := bb*bb - 4*aa*cc
 
 	// use ! > to catch cases where dsc is Inf or NaN at this point.
@@ -461,26 +568,29 @@ func (a *arc) aRange(ang1, ang2 float64, age int) {
 //   solves orbit for passed angle, converts to bin indicies, sets bin tag
 //   and updates tag count.
 func (a *arc) tagAngle(an float64) bool {
-	// compute object velocity scaled by gravitational constant
-	a.v = a.observerObjectUnit1
-	s := a.observer1Object0Mag * math.Sin(an) / math.Sin(math.Pi-an-a.tz)
-	a.v.MulScalar(&a.v, s)
-	a.v.Sub(&a.v, &a.observer1Object0)
-	a.v.MulScalar(&a.v, a.invdt*astro.InvK)
+	a.velocity(an)
 
-	// compute (some) Keplarian elements
-	sa, e, i, ok := astro.AeiHv(&a.sunObject0, &a.v, a.sunObject0Mag, &a.hv)
+	// compute Keplarian elements
+	q, e, i, ok := a.qei()
 	if !ok {
 		return false
 	}
-
-	q := sa * (1 - e)
 	iq, ie, ii, inModel := d2bin.Qei(q, e, i)
 	if !inModel {
 		return false
 	}
+	if a.fit != nil {
+		// prune orbits inconsistent with curvature of the arc
+		a.ind.Samples++
+		if !(a.angleResidual(an) <= 1) {
+			a.ind.Pruned++
+			return false
+		}
+	}
 	ih := a.hmagBin
 	bx := d2bin.Mx(iq, ie, ii, ih)
+	// node and perihelion are computed only if a class tests them
+	a.orb = d2bin.Orbit{Q: q, E: e, I: i, H: a.hmag, AnglesFunc: a.anglesFunc}
 
 	// meaning: some class was newly tagged for this bin at this distance.
 	// used as function return value, see below
@@ -488,7 +598,7 @@ func (a *arc) tagAngle(an float64) bool {
 
 	for cx, c := range a.solver.classCompute {
 		s := a.cs[cx]
-		if d2bin.CList[c].IsClass(q, e, i, a.hmag) {
+		if d2bin.CList[c].IsClass(&a.orb) {
 			if !s.dInClass[bx] {
 				s.dInClass[bx] = true
 				newTag = true
@@ -512,3 +622,59 @@ func (a *arc) tagAngle(an float64) bool {
 	// angles at this distance"
 	return newTag
 }
+
+// velocity computes object velocity for angle an, scaled by gravitational
+// constant, in a.v.
+func (a *arc) velocity(an float64) {
+	a.v = a.observerObjectUnit1
+	s := a.observer1Object0Mag * math.Sin(an) / math.Sin(math.Pi-an-a.tz)
+	a.v.MulScalar(&a.v, s)
+	a.v.Sub(&a.v, &a.observer1Object0)
+	a.v.MulScalar(&a.v, a.invdt*astro.InvK)
+}
+
+// qei computes perihelion distance, eccentricity, and inclination of the
+// orbit with position a.sunObject0 and velocity a.v, leaving the angular
+// momentum vector in a.hv and the eccentricity vector in a.ev.
+//
+// Unlike astro.AeiHv it has no limits on a or e.  q is computed as
+// h^2 / (1 + e), which is stable for near parabolic and unbound orbits.
+// Distant orbits with a over 100 AU, such as those of the scattered disk,
+// and orbits with e over .99 are thus solved.  ok is false only for
+// radial motion.
+func (a *arc) qei() (q, e float64, i unit.Angle, ok bool) {
+	h := &a.hv
+	h.Cross(&a.sunObject0, &a.v)
+	hsq := h.Square()
+	if hsq == 0 {
+		return
+	}
+	// eccentricity vector, v x h - r/|r|, with gravitational parameter 1
+	// as v is scaled by astro.InvK.
+	a.ev.Cross(&a.v, h)
+	a.ev.X -= a.sunObject0.X / a.sunObject0Mag
+	a.ev.Y -= a.sunObject0.Y / a.sunObject0Mag
+	a.ev.Z -= a.sunObject0.Z / a.sunObject0Mag
+	e = math.Sqrt(a.ev.Square())
+	q = hsq / (1 + e)
+	i = unit.Angle(math.Acos(math.Max(-1, math.Min(1, h.Z/math.Sqrt(hsq)))))
+	return q, e, i, true
+}
+
+// nodePeri computes the longitude of the ascending node and argument of
+// perihelion of the orbit solved by qei, from the vectors it leaves in
+// a.hv and a.ev.  For zero inclination the node is taken as 0.
+func (a *arc) nodePeri() (node, peri unit.Angle) {
+	h := &a.hv
+	n := math.Atan2(h.X, -h.Y)
+	if h.X == 0 && h.Y == 0 {
+		n = 0
+	}
+	sn, cn := math.Sincos(n)
+	// components of the eccentricity vector along the ascending node and
+	// 90 degrees ahead of it in the orbit plane
+	x := a.ev.X*cn + a.ev.Y*sn
+	hm := math.Sqrt(h.Square())
+	y := (-a.ev.X*sn*h.Z + a.ev.Y*cn*h.Z + a.ev.Z*(h.X*sn-h.Y*cn)) / hm
+	return unit.Angle(n), unit.Angle(math.Atan2(y, x))
+}
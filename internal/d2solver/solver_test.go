@@ -0,0 +1,158 @@
+// Public domain.
+
+package d2solver
+
+import (
+	"math"
+	"testing"
+
+	"github.com/soniakeys/astro"
+	"github.com/soniakeys/coord"
+	"github.com/soniakeys/digest2/internal/d2bin"
+	"github.com/soniakeys/observation"
+	"github.com/soniakeys/unit"
+	xrand "golang.org/x/exp/rand"
+)
+
+// qei solves orbits outside the limits of astro.AeiHv.  Velocities are in
+// units of astro.K so at 1 AU a circular orbit has speed 1 and a parabolic
+// orbit speed sqrt(2).
+func TestQEI(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		r, v    coord.Cart
+		q, e, i float64 // i in degrees
+		ok      bool
+	}{
+		{"circular", coord.Cart{X: 1}, coord.Cart{Y: 1}, 1, 0, 0, true},
+		{"inclined", coord.Cart{X: 1}, coord.Cart{Y: .5, Z: math.Sqrt(.75)},
+			1, 0, 60, true},
+		{"retrograde", coord.Cart{X: 1}, coord.Cart{Y: -1}, 1, 0, 180, true},
+		// a = 1000 AU, beyond the 100 AU limit of astro.AeiHv
+		{"large a", coord.Cart{X: 1}, coord.Cart{Y: math.Sqrt(2 - 1e-3)},
+			1, .999, 0, true},
+		{"parabolic", coord.Cart{X: 1}, coord.Cart{Y: math.Sqrt2},
+			1, 1, 0, true},
+		{"hyperbolic", coord.Cart{X: 1}, coord.Cart{Y: 2}, 1, 3, 0, true},
+		// past perihelion, q = h^2 / (1 + e) with h = 2, e = 3
+		{"hyperbolic outbound", coord.Cart{X: 2}, coord.Cart{X: math.Sqrt2, Y: 1},
+			1, 3, 0, true},
+		{"radial", coord.Cart{X: 1}, coord.Cart{X: 2}, 0, 0, 0, false},
+	} {
+		a := &arc{sunObject0: tc.r, v: tc.v}
+		a.sunObject0Mag = math.Sqrt(tc.r.Square())
+		q, e, i, ok := a.qei()
+		if ok != tc.ok {
+			t.Errorf("%s: ok = %t, want %t", tc.name, ok, tc.ok)
+			continue
+		}
+		if !ok {
+			continue
+		}
+		if math.Abs(q-tc.q) > 1e-9 || math.Abs(e-tc.e) > 1e-9 ||
+			math.Abs(i.Deg()-tc.i) > 1e-6 {
+			t.Errorf("%s: q, e, i = %g, %g, %g, want %g, %g, %g",
+				tc.name, q, e, i.Deg(), tc.q, tc.e, tc.i)
+		}
+	}
+}
+
+// tracklet returns an arc of observations from site par at times mjd of an
+// object at heliocentric ecliptic position pos(mjd).  Light time is ignored.
+func tracklet(par *observation.ParallaxConst, pos func(mjd float64) coord.Cart,
+	mjd ...float64) *observation.Arc {
+	var a arc
+	tk := &observation.Arc{Desig: "test"}
+	for _, t := range mjd {
+		o := &observation.SiteObs{
+			VMeas: observation.VMeas{MJD: t, Qual: "test"}, Par: par}
+		so := a.sov(o) // also sets a.soe, a.coe
+		p := pos(t)
+		p.Sub(&p, &so)
+		p.RotateX(&p, -a.soe, a.coe)
+		o.RA = unit.RAFromRad(math.Atan2(p.Y, p.X))
+		o.Dec = unit.Angle(math.Asin(p.Z / math.Sqrt(p.Square())))
+		tk.Obs = append(tk.Obs, o)
+	}
+	return tk
+}
+
+// geocenter is a site at the center of the Earth.
+var geocenter = &observation.ParallaxConst{}
+
+// twoBody returns the heliocentric position function of the orbit with
+// position r0 and velocity v0, in AU and AU/day, at time mjd0.
+func twoBody(r0, v0 coord.Cart, mjd0 float64) func(float64) coord.Cart {
+	return func(mjd float64) coord.Cart {
+		return propagate(&r0, &v0, astro.U, mjd-mjd0)
+	}
+}
+
+// earth returns the heliocentric ecliptic position of the Earth at mjd.
+func earth(mjd float64) coord.Cart {
+	var a arc
+	return a.sov(&observation.SiteObs{VMeas: observation.VMeas{MJD: mjd},
+		Par: geocenter})
+}
+
+// testSolver returns a solver with an empty model of a few bins and obsErr
+// for all observations.
+func testSolver(t *testing.T, obsErr unit.Angle) *D2Solver {
+	t.Cleanup(d2bin.CurrentPartitions().Set)
+	(&d2bin.Partitions{
+		Q: []float64{1, 2, 5.5, 100},
+		E: []float64{.5, 1.1},
+		I: []unit.Angle{unit.AngleFromDeg(180)},
+		H: []float64{15, 20, 25},
+	}).Set()
+	return New(&d2bin.File{All: *d2bin.New()}, nil, nil, obsErr)
+}
+
+const testMJD = 60000
+
+// mainBeltOrbit is the heliocentric position function of a circular orbit
+// at 2.5 AU, at opposition at testMJD.
+func mainBeltOrbit() func(float64) coord.Cart {
+	e := earth(testMJD)
+	var r0, v0 coord.Cart
+	r0.MulScalar(&e, 2.5/math.Sqrt(e.Square()))
+	v0 = coord.Cart{X: -r0.Y, Y: r0.X}
+	v0.MulScalar(&v0, math.Sqrt(astro.U/2.5)/2.5)
+	return twoBody(r0, v0, testMJD)
+}
+
+// mainBelt is a tracklet from site par of mainBeltOrbit.
+func mainBelt(par *observation.ParallaxConst,
+	mjd ...float64) *observation.Arc {
+	return tracklet(par, mainBeltOrbit(), mjd...)
+}
+
+// interstellar is a tracklet of an object .1 AU beyond the Earth at
+// opposition, moving at 50 km/s.
+func interstellar(mjd ...float64) *observation.Arc {
+	e := earth(testMJD)
+	var r0 coord.Cart
+	r0.MulScalar(&e, 1.1)
+	v0 := coord.Cart{X: -e.Y, Y: e.X, Z: .5}
+	v0.MulScalar(&v0, 50/1731.456837/math.Sqrt(v0.Square()))
+	return tracklet(geocenter, twoBody(r0, v0, testMJD), mjd...)
+}
+
+// Unbound samples orbits only when selected.
+func TestUnbound(t *testing.T) {
+	s := testSolver(t, unit.AngleFromSec(1))
+	rnd := xrand.New(&xrand.PCGSource{})
+	is := interstellar(testMJD, testMJD+.04)
+	if _, _, ind := s.Solve(is, 20, rnd); ind.Unbound != 0 || ind.Far != 0 {
+		t.Fatal("unbound sampled when not selected:", ind)
+	}
+	s.Unbound = true
+	_, _, ind := s.Solve(is, 20, rnd)
+	_, _, mb := s.Solve(mainBelt(geocenter, testMJD, testMJD+.04), 20, rnd)
+	if ind.Unbound < 50 || ind.Far > ind.Unbound {
+		t.Fatal("interstellar", ind)
+	}
+	if mb.Unbound >= ind.Unbound || mb.Far >= ind.Far {
+		t.Fatal("main belt", mb, "not less unbound than interstellar", ind)
+	}
+}
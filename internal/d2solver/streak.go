@@ -0,0 +1,75 @@
+// Public domain.
+
+package d2solver
+
+import (
+	"math"
+
+	"github.com/soniakeys/observation"
+	"github.com/soniakeys/unit"
+)
+
+// Streak is an observation of a streaked detection, a single position with
+// the rate and direction of motion measured from the streak.
+//
+// Solve accepts an arc of a single Streak.  It synthesizes the two endpoints
+// of the motion vector from the rate and direction of motion.
+type Streak struct {
+	observation.VObs
+	Rate    unit.Angle // per day
+	PA      unit.Angle // position angle of motion, east of north
+	RateErr unit.Angle // uncertainty of Rate, per day
+	PAErr   unit.Angle // uncertainty of PA
+}
+
+// streakDt is the time between the endpoints synthesized for a Streak,
+// in days.
+const streakDt = .02
+
+// streakEnds sets a.first and a.last to endpoints synthesized for s, along
+// the great circle of motion and centered on the time of s.  It returns the
+// error of the endpoints, that which gives the uncertainty of the motion.
+func (a *arc) streakEnds(s *Streak) (endErr unit.Angle) {
+	rho := s.Rate.Mul(streakDt / 2)
+	mjd := s.Meas().MJD
+	a.first = streakEnd(s, mjd-streakDt/2, s.PA+math.Pi, rho)
+	a.last = streakEnd(s, mjd+streakDt/2, s.PA, rho)
+	return unit.Angle(math.Hypot(s.RateErr.Rad(), s.Rate.Rad()*s.PAErr.Rad()) *
+		streakDt)
+}
+
+// streakEnd returns a copy of the observation of s moved to time mjd,
+// at distance rho in position angle pa.
+//
+// Observations of types other than SiteObs and SatObs keep the observer
+// position of s.
+func streakEnd(s *Streak, mjd float64, pa, rho unit.Angle) observation.VObs {
+	var o observation.VObs
+	switch so := s.VObs.(type) {
+	case *observation.SiteObs:
+		c := *so
+		o = &c
+	case *observation.SatObs:
+		c := *so
+		o = &c
+	default:
+		o = &movedObs{VObs: so, m: *so.Meas()}
+	}
+	m := o.Meas()
+	m.MJD = mjd
+	sd, cd := m.Dec.Sincos()
+	sr, cr := rho.Sincos()
+	sp, cp := pa.Sincos()
+	sd2 := sd*cr + cd*sr*cp
+	m.Dec = unit.Angle(math.Asin(sd2))
+	m.RA = m.RA.Add(unit.HourAngle(math.Atan2(sp*sr*cd, cr-sd*sd2)))
+	return o
+}
+
+// movedObs is an observation with the measurement replaced.
+type movedObs struct {
+	observation.VObs
+	m observation.VMeas
+}
+
+func (o *movedObs) Meas() *observation.VMeas { return &o.m }
@@ -0,0 +1,77 @@
+// Public domain.
+
+package d2solver
+
+import (
+	"math"
+	"testing"
+
+	"github.com/soniakeys/coord"
+	"github.com/soniakeys/observation"
+	"github.com/soniakeys/unit"
+	xrand "golang.org/x/exp/rand"
+)
+
+// streak returns a Streak of the middle observation of a tracklet of three,
+// with the motion of the other two.
+func streak(tk *observation.Arc) *Streak {
+	m0, m, m1 := tk.Obs[0].Meas(), tk.Obs[1].Meas(), tk.Obs[2].Meas()
+	dt := m1.MJD - m0.MJD
+	x := (m1.RA.Angle() - m0.RA.Angle()).Rad() * m.Dec.Cos()
+	y := (m1.Dec - m0.Dec).Rad()
+	return &Streak{
+		VObs: tk.Obs[1],
+		Rate: unit.Angle(math.Hypot(x, y) / dt),
+		PA:   unit.Angle(math.Atan2(x, y)),
+	}
+}
+
+// geoObs is an observation of a type unknown to the solver, from the
+// geocenter.
+type geoObs struct{ observation.VMeas }
+
+func (o *geoObs) Meas() *observation.VMeas { return &o.VMeas }
+
+func (o *geoObs) EarthObserverVect() (c coord.Cart) { return }
+
+// A single Streak solves as the tracklet of its endpoints.
+func TestStreak(t *testing.T) {
+	s := testSolver(t, unit.AngleFromSec(1))
+	s.Unbound = true
+	rnd := xrand.New(&xrand.PCGSource{})
+	times := []float64{testMJD - streakDt/2, testMJD, testMJD + streakDt/2}
+	for _, tk := range []*observation.Arc{
+		mainBelt(site, times...),
+		interstellar(times...),
+	} {
+		st := streak(tk)
+		a := s.newArc(&observation.Arc{Obs: []observation.VObs{st}}, 20, rnd)
+		if e := a.streakEnds(st); e != 0 {
+			t.Fatal("end error", e, "with no uncertainty of motion")
+		}
+		for _, p := range [][2]observation.VObs{
+			{a.first, tk.Obs[0]}, {a.last, tk.Obs[2]}} {
+			got, want := p[0].Meas(), p[1].Meas()
+			if math.Abs(got.MJD-want.MJD) > 1e-9 ||
+				math.Abs((got.RA.Angle()-want.RA.Angle()).Sec()) > .01 ||
+				math.Abs((got.Dec-want.Dec).Sec()) > .01 {
+				t.Fatalf("streak end %+v, want %+v", *got, *want)
+			}
+		}
+		ends := &observation.Arc{Obs: []observation.VObs{tk.Obs[0], tk.Obs[2]}}
+		_, _, want := s.Solve(ends, 20, rnd)
+		_, _, got := s.Solve(&observation.Arc{Obs: []observation.VObs{st}},
+			20, rnd)
+		if math.Abs(got.Unbound-want.Unbound) > 1 {
+			t.Fatal("streak", got, "endpoints", want)
+		}
+	}
+	// unknown observation types keep the observer where it was
+	st := streak(interstellar(times...))
+	_, _, want := s.Solve(&observation.Arc{Obs: []observation.VObs{st}}, 20, rnd)
+	st.VObs = &geoObs{*st.Meas()}
+	_, _, got := s.Solve(&observation.Arc{Obs: []observation.VObs{st}}, 20, rnd)
+	if got != want {
+		t.Fatal("unknown observation type", got, "geocentric", want)
+	}
+}
@@ -14,11 +14,17 @@ import (
 // twoObs computes two observations suitable for computing motion vector.
 // in the process it also computes an rms of great circle residuals.
 //
-// at least two obs must be in  a.obs.  a.rms is set to the rms over
-// the whole tracklet.  Return values firstRms and lastRms will be
+// at least two obs must be in  a.obs, or a single Streak.  a.rms is set to
+// the rms over the whole tracklet.  Return values firstRms and lastRms will be
 // non-zero if a GC fit applies to the corresponding motion vector endpoint.
+// For a Streak they are the endpoint error derived from the uncertainty of
+// the motion.
 func (a *arc) twoObs() (firstRms, lastRms unit.Angle) {
 	obs := a.obs.Obs
+	if len(obs) == 1 {
+		e := a.streakEnds(obs[0].(*Streak))
+		return e, e
+	}
 	// default obs
 	a.first = obs[0]
 	a.last = obs[len(obs)-1]
@@ -0,0 +1,58 @@
+// Public domain.
+
+package d2solver
+
+import "math"
+
+// parameters for sampling unbound orbits
+const (
+	unboundDistances = 100 // distances sampled
+	unboundAngles    = 50  // angles sampled at each distance
+	// largest hyperbolic excess velocity sampled, 50 km/s in AU/day.
+	// 1I and 2I had about 26 and 32 km/s.
+	vInfMax = 50 / 1731.456837
+)
+
+// unbound sets the indicators Unbound and Far.
+//
+// Unlike the search for scores, which explores only bound orbits, it
+// samples orbits with hyperbolic excess velocity up to vInfMax, at
+// distances spaced logarithmically from min_distance to max_distance, and
+// at each distance, evenly spaced angles from the limits of solveAngleRange.
+// Observational error is not considered.  The indicators are the
+// percentages of orbits sampled with e >= 1 and e > 1.1.  If no orbits are
+// sampled, all solutions exceed vInfMax and both are 100.
+func (a *arc) unbound() {
+	a.offsetMotionVector(0, 0)
+	var n, nUnbound, nFar int
+	lr := math.Log(max_distance / min_distance)
+	for dx := 0; dx < unboundDistances; dx++ {
+		d := min_distance * math.Exp(lr*(float64(dx)+.5)/unboundDistances)
+		a.solveDistanceDependentVectors(d)
+		ang1, ang2, ok := a.solveAngleRange(vInfMax * vInfMax)
+		if !ok {
+			continue
+		}
+		step := (ang2 - ang1) / unboundAngles
+		for ax := 0; ax < unboundAngles; ax++ {
+			a.velocity(ang1 + (float64(ax)+.5)*step)
+			_, e, _, ok := a.qei()
+			if !ok {
+				continue
+			}
+			n++
+			if e >= 1 {
+				nUnbound++
+				if e > 1.1 {
+					nFar++
+				}
+			}
+		}
+	}
+	if n == 0 {
+		a.ind.Unbound, a.ind.Far = 100, 100
+		return
+	}
+	a.ind.Unbound = 100 * float64(nUnbound) / float64(n)
+	a.ind.Far = 100 * float64(nFar) / float64(n)
+}
@@ -5,36 +5,250 @@ Usage
 
 Command line options:
 
-  muk                                  Use default location for astorb.dat.
-  muk -v                               Display version and copyright.
-  muk -a=<muk source path>/astorb.dat  Specify astorb.dat path or file name.
+  muk [options]    Build digest2.gmodel.
+  muk -v           Display version and copyright.
+
+  -a <path>        Orbit catalog path or file name.
+  -s <path>        s3m.bin or s3m.dat path.
+  -m <path>        Output model path.
+  -url <urls>      Comma separated astorb.dat download URLs.
+  -sha256 <sum>    Checksum of the download.
+  -offline         Never access the network.
+  -noid <list>     Comma separated identification thresholds, default 1'.
+  -unc <field>     Catalog uncertainty field.
+  -uncyear <year>  Minimum year of the uncertainty date, default 2000.
+  -epochs <list>   Comma separated dates for epoch specific models.
+  -asof <date>     Exclude orbits first observed after date.
+  -check           Validate the orbit catalog without building a model.
+  -maxerr <n>      Maximum number of parse errors shown, default 10.
+  -report <path>   Write a completeness report, - for standard output.
+  -csv <path>      Write the completeness report as CSV.
 
 Input
 
 The program reads two files:
 
-    s3m.dat, the S3M binned model.
-    astorb.dat, the Lowell orbit catalog.
+    s3m.bin or s3m.dat, the S3M binned model.
+    astorb.dat, the Lowell orbit catalog, or another orbit catalog.
+
+Unless specified with -s and -a, both files are searched for in the
+locations digest2 uses for its data files:  directories listed in the
+environment variable DIGEST2_PATH, the XDG data directories, the directory
+of the executable, and for GOPATH builds, the source directory.  See the
+digest2 documentation for details.  The command "digest2 paths" lists the
+locations.
+
+A copy of s3m.dat is included with the source code in the muk directory,
+but it can also be regenerated from the original S3M data files by the the
+program s3mbin.  For module builds, either copy it to one of the searched
+locations or specify it with -s.  s3mbin writes s3m.bin, a binary format
+that is faster to read and has a checksum.  Without -s, s3m.bin is
+searched for first, then s3m.dat.  With -s, either format is accepted.
+The partitions and class headings are checked in either case.  The orbit
+classes of the model, including any defined with s3mbin -classes, are
+those of the binned model.
+
+The model partitions, the bin limits in q, e, i, and H, are those of
+the binned model.  They are carried into the model file and used by digest2.
+To build a model with other partitions, give s3mbin a partition spec file.
+
+The s3m.dat distributed in the muk directory predates the current default
+partitions and classes of s3mbin.  It lacks the q limits 1.017, 5.2, and
+25 AU and the H limits 4, 5, 7, and 9, and has only the classes Int,
+NEO, N22, N18, MC, Hun, Pho, MB1, Pal, Han, MB2, MB3, Hil, JTr, and JFC.  A model
+built from it cannot score the classes Ati, Ate, Apo, Amo, PHA, Cen, TNO,
+SDO, or LPC, and muk lists the built in classes it lacks.  To score them,
+download the S3M files, unzip them in a directory, and regenerate the binned
+model before running muk:
+
+    S3M=<directory of S3M files> s3mbin -lpc -text s3m.dat
+    muk
 
-s3m.dat is required to be in the muk package source directory.  A copy of
-this file is included with the source code, but it can also be regenerated
-from the original S3M data files by the the program s3mbin.
+s3mbin writes s3m.bin, which muk finds first, and with -text also a new
+s3m.dat in the text format distributed.  Omit -lpc to leave out long period
+comets.
 
-astorb.dat will also be taken from the muk package source directory by default,
-but if it is not found an attempt will be made to fetch it with wget.
+If astorb.dat is not found an attempt will be made to download it.
+It is saved in the first directory of DIGEST2_PATH or if that is not set,
+in the XDG data home directory, typically ~/.local/share/digest2.
 Fetching a copy of astorb.dat is time consuming but only has to be done once.
 
 If you happen to have a copy of astorb.dat in another location or with another
-file name, you can specify this with the -a option.  If the file is not found
+file name, you can specify this with the -a option.  A file name without a
+directory is searched for in the locations above.  If the file is not found
 in this case, the program fails with an error message and does not attempt
 to download astorb.dat.
 
+Orbit catalogs
+
+Three catalog formats are supported and the format is detected automatically:
+
+    astorb.dat, the Lowell fixed width format.
+    MPCORB.DAT, the MPC fixed width format, with or without the header.
+    MPCORB JSON, the MPC JSON format, such as mpcorb_extended.json.
+
+Catalogs may be gzip compressed, as downloaded, and are decompressed
+while reading.  Line endings may be LF or CRLF and trailing white space
+is ignored.
+
+When -a is not given and astorb.dat is not found, astorb.dat.gz,
+MPCORB.DAT, mpcorb_extended.json, and their .gz forms are searched for
+before attempting a download.
+
+Records that can't be parsed, such as truncated lines or fields that are
+not valid numbers, are skipped.  For each, the line number, or record number
+for the JSON format, and the field are shown, up to the number given with
+-maxerr.  The total is shown at the end.
+
+Option -check reads and validates the catalog only.  It shows the same
+diagnostics and counts but does not read the binned model or write a model.
+The exit status is non-zero if any record failed to parse.
+
+Identifiability
+
+The unknown population model is the modeled population less known orbits
+that are readily identifiable, meaning their ephemeris uncertainty is not
+more than an identification threshold.  The default threshold is 1'.
+
+Option -noid gives a list of thresholds and an unknown model is built for
+each.  Thresholds are in arc seconds, optionally followed by " or s, or in
+arc minutes, followed by ' or m.  For example,
+
+    muk -noid 10s,1m,10m
+
+builds three models, named 10", 1', and 10'.  The complete population model
+uses known orbits within 1' regardless of -noid, so that raw scores do not
+depend on which unknown models are built.
+
+The uncertainty measure depends on the catalog and can be selected with -unc.
+For astorb.dat the fields are
+
+    ceu    current ephemeris uncertainty
+    peu    next peak ephemeris uncertainty
+    gpeu   greatest peak ephemeris uncertainty in the next 10 years
+    gpeu2  as gpeu, but if two more observations are made
+
+The default is gpeu.  The uncertainty is considered valid only if the date
+associated with the field is in the year given by -uncyear or later,
+default 2000.
+
+For the MPC formats the only field is u, the uncertainty parameter U.
+It is mapped to the upper bound of its range of ephemeris uncertainty:
+
+    U  arc seconds
+    0       1.0
+    1       4.4
+    2      19.6
+    3      86.5
+    4     382
+    5    1692
+    6    7488
+    7   33121
+    8  146502
+    9  no bound
+
+With the default threshold of 1', U = 2 or better qualifies as identifiable.
+U values E, D, F, and blank indicate no uncertainty could be computed.
+These orbits are considered not identifiable.
+
+Epoch specific models
+
+The uncertainty fields above are static.  They do not reflect the
+uncertainty at the time a tracklet is observed, which matters when scoring
+old tracklets or planning future observations.  Option -epochs gives a list
+of dates, as yyyy-mm-dd, and for each threshold an unknown model is built for
+each date.  For example,
+
+    muk -epochs 2010-01-01,2015-01-01,2020-01-01,2025-01-01
+
+The uncertainty of each orbit at each date is estimated from the astorb.dat
+current ephemeris uncertainty, its rate of change, and the next and greatest
+peak ephemeris uncertainties, with their dates.  The estimate is linear
+between these points and constant after the last.  Before the date of the
+current uncertainty, it grows at the rate of change.  Options -unc and
+-uncyear do not apply to epoch specific models.  Epoch specific models are
+not supported for the MPC formats.
+
+Digest2 interpolates between the two models with epochs bracketing the mean
+observation date of a tracklet.  Before the first epoch or after the last it
+uses the nearest model.
+
+As-of-date models
+
+To evaluate digest2 on historical tracklets, the known population should be
+as it was at the time of the tracklets, not as it is today.  Option -asof
+gives a cutoff date, as yyyy-mm-dd.  Orbits first observed after the cutoff
+are excluded from the known population, as are orbits where the date of first
+observation can't be determined.  The cutoff is recorded in the model file
+and shown by digest2 -v.
+
+The date of first observation is determined from the catalog.  In MPCORB.DAT
+and the JSON format, for multi-opposition orbits it is the first year of the
+arc, taken as the start of the year.  For single-opposition orbits it is the
+date of last observation less the arc length in days.  astorb.dat does not
+carry the date of first observation so it is estimated as the date of orbit
+computation less the arc length in days.
+
+Known orbits at the cutoff date generally had larger uncertainties than they
+do in a current catalog.  Using -epochs with the cutoff date as an epoch
+accounts for this, approximately.
+
+Downloading
+
+By default astorb.dat.gz is downloaded from Lowell Observatory,
+
+    https://ftp.lowell.edu/pub/elgb/astorb.dat.gz
+
+Other locations can be given with -url or the environment variable
+DIGEST2_ASTORB_URL, as a comma separated list of mirrors to try in order.
+URLs may be http, https, or file URLs, for example
+
+    muk -url http://mirror.example.org/astorb.dat.gz,file:///data/astorb.dat.gz
+
+Progress is shown during the download.  The download goes first to
+astorb.dat.part, with the URL recorded in astorb.dat.part.url.  If a
+download is interrupted, running muk again resumes it from where it left
+off, as long as it is from the same URL.  A partial download from another
+URL is discarded.  If the partial download does not match the size of the
+content, as when the file on the server has changed, the download starts
+over.  Gzip compressed content is decompressed automatically.
+
+With -sha256, the checksum of the downloaded content, as served and before
+decompression, is verified.  On a mismatch the download is discarded and
+the next URL is tried.
+
+With -offline, or if the environment variable DIGEST2_OFFLINE is set to
+any non-empty value, http and https URLs are never accessed.  File URLs
+still work, so an offline installation can use a local mirror.
+
 Output
 
 The output is a single file, digest2.gmodel, containing a merging of the inputs
-in a format readily useful to digest2.  This format is the Go "gob" format, a
+in a format readily useful to digest2.  A header records the catalog used,
+the uncertainty field, and the unknown models.  It is written to the location given
+with -m, or by default where digest2 looks for it first, the first directory
+of DIGEST2_PATH or the XDG data home directory.  This format is the Go "gob" format, a
 binary format that is not human readable.
 
+Completeness report
+
+Option -report writes a report of estimated completeness, the number of
+known orbits divided by the modeled population, for the whole population and
+for each orbit class, broken down by H bin.  Option -csv writes the same
+numbers as CSV.  A path of - writes to standard output.
+
+Known orbits are all orbits of the catalog in the model space, whatever
+their uncertainty, so that the report does not depend on -noid.  The modeled population is
+summed over the (q, e, i) bins as the greater of the S3M count and the known
+count.  The Over column counts bins where known orbits exceed the S3M count.
+These bins, marked with *, indicate the S3M model underestimates the real
+population.  The CSV columns are
+
+    class, h_min, h_max, s3m, known, modeled, completeness, over_bins
+
+Completeness is empty in the CSV, and - in the text report, where nothing is
+modeled.
+
 -------------
 Public domain.
 */
@@ -3,65 +3,85 @@
 package main
 
 import (
-	"bufio"
-	"compress/gzip"
-	"encoding/gob"
+	"errors"
 	"flag"
 	"fmt"
-	"go/build"
 	"io"
-	"log"
-	"math"
 	"os"
-	"os/exec"
 	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
 
+	"github.com/soniakeys/digest2/internal/catalog"
 	"github.com/soniakeys/digest2/internal/d2bin"
+	"github.com/soniakeys/digest2/internal/d2build"
+	"github.com/soniakeys/digest2/internal/d2fetch"
+	"github.com/soniakeys/digest2/internal/d2path"
 	"github.com/soniakeys/exit"
-	"github.com/soniakeys/unit"
 )
 
-const parentImport = "digest2"
 const versionString = "muk version 0.2 Go source."
 const copyrightString = "Public domain."
 const aofn = "astorb.dat"
 
+// altFns are catalog file names searched for if astorb.dat is not found.
+var altFns = []string{"astorb.dat.gz", "MPCORB.DAT", "mpcorb_extended.json",
+	"MPCORB.DAT.gz", "mpcorb_extended.json.gz"}
+
+// astorbURL is the default download location for astorb.dat.
+const astorbURL = "https://ftp.lowell.edu/pub/elgb/astorb.dat.gz"
+
 func main() {
 	defer exit.Handler()
 
-	// muk package dir.  required location of s3m.dat, default location
-	// of astorb.dat
-	mukDir := ""
-	if pkg, err := build.Import(parentImport+"/muk", "",
-		build.FindOnly); err == nil {
-		mukDir = pkg.Dir
-	}
-	// parent dir of muk and digest2.  also location
-	// for output file digest2.gmodel (d2bin.Mfn)
-	parentDir := ""
-	if pkg, err := build.Import(parentImport, "", build.FindOnly); err == nil {
-		parentDir = pkg.Dir
-	}
-	// default location for astorb.dat
-	defPath := filepath.Join(mukDir, aofn)
-
 	flag.Usage = func() {
 		os.Stderr.WriteString(`Usage:
-  muk                                  Use default location for astorb.dat.
-  muk -v                               Display version and copyright.
-  muk -a=<muk source path>/astorb.dat  Specify astorb.dat path or file name.
+  muk [options]    Build digest2.gmodel.
+  muk -v           Display version and copyright.
 
-Default:
-  -a=` + defPath + `
+Options:
+  -a <path>        Orbit catalog path or file name.
+  -s <path>        s3m.bin or s3m.dat path.
+  -m <path>        Output model path.
+  -url <urls>      Comma separated astorb.dat download URLs.
+  -sha256 <sum>    Checksum of the download.
+  -offline         Never access the network.
+  -noid <list>     Comma separated identification thresholds, default 1'.
+  -unc <field>     Catalog uncertainty field.
+  -uncyear <year>  Minimum year of the uncertainty date, default 2000.
+  -epochs <list>   Comma separated dates for epoch specific models.
+  -asof <date>     Exclude orbits first observed after date.
+  -check           Validate the orbit catalog without building a model.
+  -maxerr <n>      Maximum number of parse errors shown, default 10.
+  -report <path>   Write a completeness report, - for standard output.
+  -csv <path>      Write the completeness report as CSV.
+
+Without options, files are located as described in the documentation.
+Command "digest2 paths" shows the locations searched.
 
 For full documentation:
    godoc muk
 `)
 	}
-	clPath := flag.String("a", defPath, "astorb.dat path or file name")
+	clPath := flag.String("a", "", "orbit catalog path or file name")
+	sPath := flag.String("s", "", "s3m.bin or s3m.dat path")
+	mPath := flag.String("m", "", "output model path")
+	urls := flag.String("url", envDefault("DIGEST2_ASTORB_URL", astorbURL),
+		"astorb.dat download URLs")
+	sum := flag.String("sha256", "", "astorb.dat download checksum")
+	offline := flag.Bool("offline", os.Getenv("DIGEST2_OFFLINE") > "",
+		"never access the network")
+	noid := flag.String("noid", "1'", "identification thresholds")
+	uncName := flag.String("unc", "", "catalog uncertainty field")
+	uncYear := flag.Int("uncyear", 2000, "minimum year of uncertainty date")
+	epochList := flag.String("epochs", "", "epochs for epoch specific models")
+	asOfDate := flag.String("asof", "", "cutoff date for known orbits")
+	check := flag.Bool("check", false, "validate the orbit catalog only")
+	maxErr := flag.Int("maxerr", 10, "maximum parse errors to show")
+	report := flag.String("report", "", "completeness report path")
+	csvPath := flag.String("csv", "", "completeness CSV path")
 	vers := flag.Bool("v", false, "display version and copyright")
 	flag.Parse()
 	if *vers {
@@ -73,328 +93,397 @@ For full documentation:
 		flag.Usage()
 		os.Exit(1)
 	}
+	thresholds, err := parseThresholds(*noid)
+	if err != nil {
+		exit.Log(err)
+	}
+	epochs, err := parseEpochs(*epochList)
+	if err != nil {
+		exit.Log(err)
+	}
+	var asOf float64 // as MJD, 0 for no cutoff
+	var asOfTime time.Time
+	if *asOfDate > "" {
+		if asOfTime, err = time.Parse("2006-01-02", *asOfDate); err != nil {
+			exit.Log(fmt.Errorf("invalid -asof date %q", *asOfDate))
+		}
+		asOf = catalog.TimeMJD(asOfTime)
+	}
+	fetcher := &d2fetch.Fetcher{
+		URLs:     d2fetch.SplitURLs(*urls),
+		SHA256:   *sum,
+		Offline:  *offline,
+		Progress: os.Stdout,
+	}
 	astorbPath := *clPath
-	switch {
-	case astorbPath != defPath:
-		// user specified a path or file name.  see if it needs to be fixed up.
-		clDir, clFile := filepath.Split(*clPath)
-		if clDir == "" {
-			// add default directory
-			astorbPath = filepath.Join(mukDir, clFile)
+	switch clDir, clFile := filepath.Split(astorbPath); {
+	case astorbPath == "":
+		// user took default.  we're happy if it is found, ...
+		loc, found := d2path.Find(aofn, d2path.Data)
+		astorbPath = loc.Path
+		if found {
 			break
 		}
-		fi, statErr := os.Stat(*clPath)
-		if statErr != nil {
-			exit.Log(statErr)
-		}
-		if fi.IsDir() {
-			// add default file name
-			astorbPath = filepath.Join(*clPath, aofn)
-		}
-	default:
-		// user took default.  we're happy if it stats, ...
-		if _, err := os.Stat(defPath); err == nil {
+		// or with a compressed or MPC catalog in place of astorb.dat.
+		if c, ok := findAlt(); ok {
+			astorbPath = c.Path
 			break
 		}
-		// otherwise try wget.  (Go code would be nice here but existing
-		// packages I found didn't have progress features, which are
-		// important because this file is big and the site is slow.)
+		// otherwise download it.
 		fmt.Printf(`
 %s not found.
-Accessing ftp://ftp.lowell.edu/pub/elgb/astorb.dat.gz...
+Downloading from %s
 This process is often time consuming.
 
-`, defPath)
-		c := exec.Command("wget",
-			"ftp://ftp.lowell.edu/pub/elgb/astorb.dat.gz",
-			"-O", "-")
-		c.Stderr = os.Stderr
-		wOut, err := c.StdoutPipe()
-		if err != nil {
+`, aofn, strings.Join(fetcher.URLs, ", "))
+		if err := d2path.MkdirFor(astorbPath); err != nil {
 			exit.Log(err)
 		}
-		if err = c.Start(); err != nil {
+		if err := fetcher.Fetch(astorbPath); err != nil {
 			exit.Log(err)
 		}
-		// gunzip.  This we can handle.
-		uOut, err := gzip.NewReader(wOut)
-		if err != nil {
-			exit.Log(err)
+	case clDir == "":
+		// user specified a file name only.  search for it.
+		if c, found := d2path.Find(clFile, d2path.Data); found {
+			astorbPath = c.Path
 		}
-		f, err := os.Create(defPath)
-		if err != nil {
-			exit.Log(err)
+	default:
+		// user specified a path.  see if it needs a file name.
+		fi, statErr := os.Stat(astorbPath)
+		if statErr != nil {
+			exit.Log(statErr)
 		}
-		if _, err = io.Copy(f, uOut); err != nil {
-			exit.Log(err)
+		if fi.IsDir() {
+			// add default file name
+			astorbPath = filepath.Join(astorbPath, aofn)
 		}
-		f.Close()
 	}
 
-	// S3M file required to be in muk directory.
-	sPath := filepath.Join(mukDir, d2bin.Sfn)
+	var s3m *d2bin.Model
+	if !*check {
+		if *sPath == "" {
+			c, found := d2path.Find(d2bin.Sbfn, d2path.Data)
+			if !found {
+				c, found = d2path.Find(d2bin.Sfn, d2path.Data)
+			}
+			if !found {
+				exit.Log(d2bin.Sbfn + " or " + d2bin.Sfn + ` not found.  Command "digest2 paths" shows locations searched.`)
+			}
+			*sPath = c.Path
+		}
+		s3m = readS3M(*sPath)
+	}
 
-	// in a small conflation of features, status messages show only file names
-	// if the default is used for astorb.dat, and full paths otherwise
-	if astorbPath == defPath {
-		fmt.Println("Reading", d2bin.Sfn)
-	} else {
-		fmt.Println("Reading", sPath)
+	// an unknown model for each threshold, or for each threshold and epoch.
+	var specs []d2bin.UnkSpec
+	for _, t := range thresholds {
+		n := d2bin.UnkName(t)
+		if len(epochs) == 0 {
+			specs = append(specs, d2bin.UnkSpec{Name: n, Arcsec: t})
+		}
+		for _, e := range epochs {
+			specs = append(specs, d2bin.UnkSpec{Name: n, Arcsec: t, Epoch: e})
+		}
 	}
+	_, aoFile := filepath.Split(astorbPath)
+	fmt.Printf("Reading %s...\n", astorbPath)
 
-	f, err := os.Open(sPath)
+	forb, err := os.Open(astorbPath)
 	if err != nil {
 		exit.Log(err)
 	}
-	bf := bufio.NewReader(f)
-	var ln int
-	// close on f, ln
-	corrupt := func(i interface{}) {
-		if i != nil {
-			log.Println(i)
-		}
-		f.Close()
-		exit.Log(fmt.Errorf("%s corrupt. line %d", d2bin.Sfn, ln))
+	defer forb.Close()
+	var aoDate time.Time
+	if fi, err := forb.Stat(); err == nil {
+		aoDate = fi.ModTime()
 	}
-	mustRead := func() string {
-		ln++
-		line, isPre, err := bf.ReadLine()
-		if err != nil {
-			corrupt(err)
+	cat, err := catalog.NewReader(forb, catalog.Options{
+		Unc:     *uncName,
+		MinYear: *uncYear,
+		Hist:    len(epochs) > 0,
+	})
+	if err != nil {
+		exit.Log(fmt.Errorf("%s: %v", astorbPath, err))
+	}
+	fmt.Println("Format", cat.Format(), "uncertainty", cat.Uncertainty())
+	ko := &knownOrbits{
+		cat:    cat,
+		file:   aoFile,
+		asOf:   asOf,
+		maxErr: *maxErr,
+	}
+	var b *d2build.Builder
+	var all *d2bin.Model
+	var unk []*d2bin.Model
+	if *check {
+		for {
+			var o catalog.Orbit
+			if o, err = ko.Next(); err != nil {
+				break
+			}
+			if o.UncOK || o.Hist != nil {
+				ko.good++
+			}
 		}
-		if isPre {
-			corrupt("unexpected long line")
+	} else {
+		all, unk, b, err = d2build.Build(s3m, specs, ko)
+	}
+	if err != nil && err != io.EOF {
+		exit.Log(fmt.Errorf("%s: %v", astorbPath, err))
+	}
+
+	fmt.Println(ko.lines, "orbits in", aoFile)
+	if ko.parseFails > 0 {
+		if ko.parseFails > *maxErr {
+			fmt.Println(ko.parseFails-*maxErr, "more parse errors not shown")
 		}
-		return string(line)
+		fmt.Println(ko.parseFails, "orbits failed to parse")
 	}
-	if mustRead() != "S3M binned" {
-		corrupt(`"S3M binned" expected`)
+	if asOf != 0 {
+		if ko.undated > 0 {
+			fmt.Println(ko.undated, "orbits had no date of first observation")
+		}
+		fmt.Println(ko.later, "orbits first observed after", mjdDate(asOf))
 	}
-	readPart := func(ele byte) []float64 {
-		line := mustRead()
-		if len(line) < 1 || line[0] != ele {
-			corrupt(fmt.Sprintf("%c line expected", ele))
+	fmt.Println(ko.uncFails, "orbits had no valid ephemeris uncertainty")
+	if *check {
+		fmt.Println(ko.good, "orbits with valid ephemeris uncertainty")
+		if ko.parseFails > 0 {
+			exit.Log(fmt.Errorf("%s: %d parse errors", astorbPath, ko.parseFails))
 		}
-		flds := strings.Fields(line[1:])
-		part := make([]float64, len(flds))
-		for px, p := range flds {
-			f, err := strconv.ParseFloat(p, 64)
-			if err != nil {
-				corrupt(err)
-			}
-			part[px] = f
+		return
+	}
+	if b.OutOfModel > 0 {
+		fmt.Println(b.OutOfModel, "orbits out of model")
+	}
+	fmt.Println(b.Used, "orbits usable")
+	model := &d2bin.File{Header: d2bin.Header{
+		Catalog:       cat.Format(),
+		CatalogDate:   aoDate,
+		CatalogOrbits: ko.lines,
+		Uncertainty:   cat.Uncertainty(),
+		UnkSpecs:      specs,
+	}}
+	if asOf != 0 {
+		model.AsOf = asOfTime
+	}
+	for k, sp := range specs {
+		if sp.Epoch == 0 {
+			fmt.Println(b.Identified[k], "orbits identifiable within", sp.Name)
+		} else {
+			fmt.Println(b.Identified[k], "orbits identifiable within", sp.Name,
+				"at", mjdDate(sp.Epoch))
 		}
-		return part
-	}
-	d2bin.QPart = readPart('q')
-	d2bin.EPart = readPart('e')
-	ip := readPart('i')
-	d2bin.IPart = make([]unit.Angle, len(ip))
-	for i, p := range ip {
-		d2bin.IPart[i] = unit.AngleFromDeg(p)
-	}
-	d2bin.HPart = readPart('h')
-	d2bin.LastH = len(d2bin.HPart) - 1
-	d2bin.MSize = len(d2bin.QPart) * len(d2bin.EPart) * len(d2bin.IPart) * len(d2bin.HPart)
-	readBins := func() []float64 {
-		bins := make([]float64, d2bin.MSize)
-		for bx := 0; bx < d2bin.MSize; {
-			flds := strings.Fields(mustRead())
-			if len(flds) != len(d2bin.HPart) {
-				corrupt(len(flds))
+	}
+
+	if *report > "" || *csvPath > "" {
+		rows := completeness(s3m, b.Cataloged)
+		for _, r := range []struct {
+			path string
+			wf   func(io.Writer, []complRow) error
+		}{{*report, writeReport}, {*csvPath, writeCSV}} {
+			var err error
+			switch r.path {
+			case "":
+				continue
+			case "-":
+				err = r.wf(os.Stdout, rows)
+			default:
+				fmt.Println("Writing", r.path)
+				err = writeFile(r.path, rows, r.wf)
 			}
-			for _, s := range flds {
-				p, err := strconv.ParseFloat(s, 64)
-				if err != nil {
-					corrupt(err)
-				}
-				bins[bx] = p
-				bx++
+			if err != nil {
+				exit.Log(err)
 			}
 		}
-		return bins
-	}
-	var s3m d2bin.Model
-	s3m.SS = readBins()
-	s3m.Class = make([][]float64, len(d2bin.CList))
-	for cx, class := range d2bin.CList {
-		if mustRead() != class.Heading {
-			corrupt(fmt.Sprintf(`class "%s" expected`, class.Heading))
-		}
-		s3m.Class[cx] = readBins()
 	}
-	f.Close()
 
-	known := d2bin.New()
-	_, aoFile := filepath.Split(astorbPath)
-	if astorbPath == defPath {
-		fmt.Printf("Reading %s...\n", aoFile)
-	} else {
-		fmt.Printf("Reading %s...\n", astorbPath)
+	model.All = *all
+	for _, u := range unk {
+		model.Unk = append(model.Unk, *u)
 	}
-
-	// Note on file size:  astorb.dat is over 100M.  I found that the
-	// following bufio code ran about twice as fast as equivalent code
-	// using ioutil.Readfile.  I usually like bufio.ReadLine, but that
-	// seems to offer a big advantage only when you can work with bytes.
-	// Here we need strconv functions, so bufio.ReadString seems best.
-	//
-	// Note also that astorb.data is ASCII encoded.
-	forb, err := os.Open(astorbPath)
+	// output goes to the default location, which digest2 searches first.
+	if *mPath == "" {
+		*mPath = d2path.Default(d2bin.Mfn, d2path.Data).Path
+		if err := d2path.MkdirFor(*mPath); err != nil {
+			exit.Log(err)
+		}
+	}
+	fbin, err := os.Create(*mPath)
 	if err != nil {
 		exit.Log(err)
 	}
-	defer forb.Close()
-	var aoDate time.Time
-	if fi, err := forb.Stat(); err == nil {
-		aoDate = fi.ModTime()
+	fmt.Println("Writing", *mPath)
+	if err := model.Write(fbin); err != nil {
+		fbin.Close()
+		exit.Log(err)
 	}
-	bfile := bufio.NewReaderSize(forb, 1<<10)
-	line, err := bfile.ReadString('\n')
-	if err != nil {
+	if err := fbin.Close(); err != nil {
 		exit.Log(err)
 	}
-	var decpeuy_fails, decpeu_rejects, parsefails, outofmodel, aoLines, good int
-	for ; err == nil; line, err = bfile.ReadString('\n') {
-		aoLines++
-		decpeuy, err := strconv.Atoi(line[242:246])
-		if err != nil || decpeuy < 2000 {
-			decpeuy_fails++
-			continue
+}
+
+// knownOrbits iterates over catalog orbits usable for the known population.
+// It skips orbits that fail to parse or are excluded by the as-of date, and
+// counts them.  It counts orbits with no valid uncertainty but passes them
+// on, as they count for catalog completeness though they are not known for
+// any model.
+type knownOrbits struct {
+	cat    *catalog.Reader
+	file   string
+	asOf   float64
+	maxErr int
+
+	lines, parseFails, undated, later, uncFails, good int
+}
+
+func (k *knownOrbits) Next() (catalog.Orbit, error) {
+	for {
+		o, err := k.cat.Next()
+		if err == io.EOF {
+			return o, err
 		}
-		word := line[234:237] + "e" + line[238:241]
-		decpeu, err := strconv.ParseFloat(word, 64)
+		k.lines++
 		if err != nil {
-			parsefails++
-			continue
-		}
-		if decpeu > 60. {
-			decpeu_rejects++
+			if _, ok := err.(*catalog.ParseError); !ok {
+				return o, err
+			}
+			if k.parseFails < k.maxErr {
+				fmt.Printf("%s: %v\n", k.file, err)
+			}
+			k.parseFails++
 			continue
 		}
-		a, err := strconv.ParseFloat(strings.TrimSpace(line[169:181]), 64)
-		if err != nil {
-			parsefails++
-			continue
+		if k.asOf != 0 {
+			switch {
+			case o.FirstObs == 0:
+				k.undated++
+				continue
+			case o.FirstObs > k.asOf:
+				k.later++
+				continue
+			}
 		}
-		e, err := strconv.ParseFloat(line[158:168], 64)
-		if err != nil {
-			parsefails++
-			continue
+		if !o.UncOK && o.Hist == nil {
+			k.uncFails++
 		}
-		i, err := strconv.ParseFloat(strings.TrimSpace(line[147:157]), 64)
-		if err != nil {
-			parsefails++
-			continue
+		return o, nil
+	}
+}
+
+// readS3M reads the binned S3M population, in binary or text format.  It
+// sets the d2bin partition variables and class list.
+func readS3M(sPath string) *d2bin.Model {
+	fmt.Println("Reading", sPath)
+	h, s3m, p, err := d2bin.ReadS3MFile(sPath)
+	if err != nil {
+		exit.Log(err)
+	}
+	p.Set()
+	d2bin.SetClasses(h.Classes, h.ClassDefs)
+	if h.Version > 0 {
+		fmt.Println(h.Orbits, "orbits binned from", len(h.Sources), "files")
+	}
+	if m := missingClasses(); len(m) > 0 {
+		fmt.Println("Classes not in", sPath+":", strings.Join(m, " "))
+		fmt.Println("Regenerate it with s3mbin to score them, " +
+			"as described in the muk documentation.")
+	}
+	return s3m
+}
+
+// missingClasses returns the abbreviations of built in classes not in
+// d2bin.CList.
+func missingClasses() (m []string) {
+classes:
+	for _, c := range d2bin.Classes {
+		for _, cl := range d2bin.CList {
+			if cl.Abbr == c.Abbr {
+				continue classes
+			}
 		}
-		ia := unit.AngleFromDeg(i)
-		h, err := strconv.ParseFloat(strings.TrimSpace(line[42:47]), 64)
-		if err != nil {
-			parsefails++
+		m = append(m, c.Abbr)
+	}
+	return
+}
+
+// parseThresholds parses a comma separated list of identification
+// thresholds.  Each is a number of arc seconds, optionally followed by
+// " or s.  A number followed by ' or m is arc minutes.
+func parseThresholds(s string) (t []float64, err error) {
+	for _, f := range strings.Split(s, ",") {
+		f = strings.TrimSpace(f)
+		m := 1.
+		switch {
+		case f == "":
 			continue
+		case strings.HasSuffix(f, "'"), strings.HasSuffix(f, "m"):
+			m = 60
+			f = f[:len(f)-1]
+		case strings.HasSuffix(f, `"`), strings.HasSuffix(f, "s"):
+			f = f[:len(f)-1]
 		}
-		q := a * (1 - e)
-		iq, ie, ii, ih, inModel := d2bin.Qeih(q, e, ia, h)
-		if !inModel {
-			outofmodel++
-			continue
+		v, err := strconv.ParseFloat(f, 64)
+		if err != nil || v <= 0 {
+			return nil, fmt.Errorf("invalid identification threshold %q", f)
 		}
-
-		good++
-		bx := d2bin.Mx(iq, ie, ii, ih)
-		known.SS[bx]++
-		for c, cs := range d2bin.CList {
-			if cs.IsClass(q, e, ia, h) {
-				known.Class[c][bx]++
+		v *= m
+		for _, x := range t {
+			if x == v {
+				return nil, fmt.Errorf("duplicate identification threshold %s",
+					d2bin.UnkName(v))
 			}
 		}
+		t = append(t, v)
 	}
-
-	fmt.Println(aoLines, "lines in", aoFile)
-	if parsefails > 0 {
-		fmt.Println(parsefails, "lines failed to parse")
-	}
-	fmt.Println(decpeuy_fails, "lines had invalid date of peak ephemeris uncertainty")
-	fmt.Println(decpeu_rejects, "oribits had excessive peak ephemeris uncertainty")
-	if outofmodel > 0 {
-		fmt.Println(outofmodel, "orbits out of model")
+	if len(t) == 0 {
+		return nil, errors.New("no identification threshold")
 	}
-	fmt.Println(good, "orbits usable")
+	return
+}
 
-	// from s3m and known, produce all=max(s3m, known)/sqrt(v)
-	// and unk=(all-known)/sqrt(v), where v is the "volume" of the d2bin.
-	all := d2bin.New()
-	unk := d2bin.New()
-	q0 := 0.
-	x := 0
-	for _, q1 := range d2bin.QPart {
-		dq := q1 - q0
-		q0 = q1
-		e0 := 0.
-		d1 := 1.
-		for _, e1 := range d2bin.EPart {
-			d0 := d1
-			d1 = 1 - e1
-			if d1 < 0 {
-				d1 = 0
-			}
-			dae := dq * (e1 - e0) / (d0 + d1)
-			e0 = e1
-			i0 := unit.Angle(0)
-			for _, i1 := range d2bin.IPart {
-				daei := dae * (i1 - i0).Deg()
-				i0 = i1
-				h0 := 0.
-				for _, h1 := range d2bin.HPart {
-					isqv := 1 / math.Sqrt(daei*(h1-h0))
-					h0 = h1
-					if known.SS[x] > s3m.SS[x] {
-						all.SS[x] = float64(known.SS[x]) * isqv
-						unk.SS[x] = 0
-					} else {
-						all.SS[x] = float64(s3m.SS[x]) * isqv
-						unk.SS[x] = float64(s3m.SS[x]-known.SS[x]) * isqv
-					}
-					for c, kc := range known.Class {
-						sc := s3m.Class[c]
-						if kc[x] > sc[x] {
-							all.Class[c][x] = float64(kc[x]) * isqv
-							unk.Class[c][x] = 0
-						} else {
-							all.Class[c][x] = float64(sc[x]) * isqv
-							unk.Class[c][x] = float64(sc[x]-kc[x]) * isqv
-						}
-					}
-					x++
-				}
-			}
+// parseEpochs parses a comma separated list of dates yyyy-mm-dd and returns
+// them as MJDs in increasing order.
+func parseEpochs(s string) (e []float64, err error) {
+	for _, f := range strings.Split(s, ",") {
+		if f = strings.TrimSpace(f); f == "" {
+			continue
 		}
+		t, err := time.Parse("2006-01-02", f)
+		if err != nil {
+			return nil, fmt.Errorf("invalid epoch %q", f)
+		}
+		e = append(e, catalog.TimeMJD(t))
 	}
-	mPath := filepath.Join(parentDir, d2bin.Mfn)
-	fbin, err := os.Create(mPath)
-	if err != nil {
-		exit.Log(err)
-	}
-	if astorbPath == defPath {
-		fmt.Println("Writing", d2bin.Mfn)
-	} else {
-		fmt.Println("Writing", mPath)
+	sort.Float64s(e)
+	for x := 1; x < len(e); x++ {
+		if e[x] == e[x-1] {
+			return nil, fmt.Errorf("duplicate epoch %s", mjdDate(e[x]))
+		}
 	}
-	defer fbin.Close()
-	enc := gob.NewEncoder(fbin)
-	mustEncode := func(i interface{}) {
-		if err := enc.Encode(i); err != nil {
-			exit.Log(err)
+	return
+}
+
+// mjdDate formats an MJD as a calendar date.
+func mjdDate(mjd float64) string {
+	return catalog.MJDTime(mjd).Format("2006-01-02")
+}
+
+// findAlt searches for an alternative orbit catalog.
+func findAlt() (d2path.Candidate, bool) {
+	for _, fn := range altFns {
+		if c, ok := d2path.Find(fn, d2path.Data); ok {
+			return c, true
 		}
 	}
-	mustEncode(&aoDate)
-	mustEncode(aoLines)
-	mustEncode(d2bin.QPart)
-	mustEncode(d2bin.EPart)
-	mustEncode(d2bin.IPart)
-	mustEncode(d2bin.HPart)
-	mustEncode(d2bin.MSize)
-	mustEncode(d2bin.LastH)
-	mustEncode(all)
-	mustEncode(unk)
+	return d2path.Candidate{}, false
+}
+
+// envDefault returns the value of environment variable v, or def if
+// v is not set.
+func envDefault(v, def string) string {
+	if s := os.Getenv(v); s > "" {
+		return s
+	}
+	return def
 }
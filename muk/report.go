@@ -0,0 +1,118 @@
+// Public domain.
+
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+
+	"github.com/soniakeys/digest2/internal/d2bin"
+)
+
+// complRow holds completeness of one population for one H bin.
+type complRow struct {
+	class   string  // class abbreviation, or "All" for the whole population
+	h0, h1  float64 // H bin limits
+	s3m     float64 // S3M synthetic count
+	known   float64 // known count
+	modeled float64 // sum over bins of max(s3m, known)
+	over    int     // number of bins where known > s3m
+}
+
+// completeness is known/modeled, or NaN if nothing is modeled.
+func (r *complRow) completeness() float64 {
+	if r.modeled == 0 {
+		return math.NaN()
+	}
+	return r.known / r.modeled
+}
+
+// completeness sums the S3M and known models over q, e, and i, giving a row
+// for each H bin of the whole population and of each class in d2bin.CList.
+func completeness(s3m, known *d2bin.Model) (rows []complRow) {
+	pop := func(class string, s, k []float64) {
+		r := make([]complRow, len(d2bin.HPart))
+		h0 := 0.
+		for ih, h1 := range d2bin.HPart {
+			r[ih] = complRow{class: class, h0: h0, h1: h1}
+			h0 = h1
+		}
+		for x, sv := range s {
+			kv := k[x]
+			rh := &r[x%len(d2bin.HPart)]
+			rh.s3m += sv
+			rh.known += kv
+			rh.modeled += math.Max(sv, kv)
+			if kv > sv {
+				rh.over++
+			}
+		}
+		rows = append(rows, r...)
+	}
+	pop("All", s3m.SS, known.SS)
+	for c, cs := range d2bin.CList {
+		pop(cs.Abbr, s3m.Class[c], known.Class[c])
+	}
+	return
+}
+
+// writeReport writes completeness as a text table.
+func writeReport(w io.Writer, rows []complRow) error {
+	fmt.Fprintln(w, "Completeness, known orbits / modeled population.")
+	fmt.Fprintln(w, "* marks H bins where known orbits exceed S3M in some (q, e, i) bins.")
+	for x, r := range rows {
+		if x == 0 || r.class != rows[x-1].class {
+			fmt.Fprintf(w, "\n%s\n%11s %10s %10s %10s %9s %5s\n",
+				r.class, "H", "S3M", "Known", "Modeled", "Complete", "Over")
+		}
+		c := "-"
+		if v := r.completeness(); !math.IsNaN(v) {
+			c = fmt.Sprintf("%.4f", v)
+		}
+		flag := ""
+		if r.over > 0 {
+			flag = " *"
+		}
+		fmt.Fprintf(w, "%11s %10.0f %10.0f %10.0f %9s %5d%s\n",
+			fmt.Sprintf("%g-%g", r.h0, r.h1), r.s3m, r.known, r.modeled,
+			c, r.over, flag)
+	}
+	_, err := fmt.Fprintln(w)
+	return err
+}
+
+// writeCSV writes completeness as CSV with a header line.
+func writeCSV(w io.Writer, rows []complRow) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"class", "h_min", "h_max", "s3m", "known", "modeled",
+		"completeness", "over_bins"})
+	g := func(f float64) string { return strconv.FormatFloat(f, 'g', -1, 64) }
+	for _, r := range rows {
+		c := ""
+		if v := r.completeness(); !math.IsNaN(v) {
+			c = g(v)
+		}
+		cw.Write([]string{r.class, g(r.h0), g(r.h1), g(r.s3m), g(r.known),
+			g(r.modeled), c, strconv.Itoa(r.over)})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// writeFile creates file fn and writes rows to it with wf.
+func writeFile(fn string, rows []complRow,
+	wf func(io.Writer, []complRow) error) error {
+	f, err := os.Create(fn)
+	if err != nil {
+		return err
+	}
+	if err := wf(f, rows); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
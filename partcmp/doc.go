@@ -0,0 +1,46 @@
+/*
+Command partcmp compares digest2 scores from two models, typically built
+with different partitions.
+
+Usage
+
+Command line options:
+
+  partcmp [options] <model A> <model B> <obsfile>
+  partcmp -v           Display version and copyright.
+
+  -o <obscode file>    default digest2.obscodes, located as by digest2
+  -noid <name>         unknown model for NoID scores, default the first
+  -list <n>            list tracklets with a score change of n or more
+
+Both models score each tracklet of the observation file.  Models are loaded
+one at a time since partitions are global to a process.  Scoring uses the
+default observational error of 1 arc second and repeatable random numbers,
+so differences come only from the models.
+
+For each orbit class, and for raw and NoID scores, the report shows the
+distribution of scores from each model in the ranges
+
+    <1  1-10  10-50  50-90  >=90
+
+and the mean score.  It then shows the mean and maximum absolute change in
+score, and the number of tracklets where the score crosses 50 between
+models.  A score of 50 is a common decision threshold, for example for
+posting to the NEO confirmation page.
+
+With -list, tracklets where any raw or NoID score changes by n or more are
+listed with the class and both scores.
+
+Building a model with other partitions
+
+Partitions are given to s3mbin in a partition spec file.  For example, for
+a model with finer bins near q = 1.3 and more H bins for small NEOs,
+
+    s3mbin -parts fine.parts s3m-fine.bin
+    muk -s s3m-fine.bin -m fine.gmodel
+    partcmp digest2.gmodel fine.gmodel test.obs
+
+-------------
+Public domain.
+*/
+package main
@@ -0,0 +1,277 @@
+// Public domain.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"reflect"
+	"runtime"
+	"sync"
+
+	xrand "golang.org/x/exp/rand"
+
+	"github.com/soniakeys/digest2/internal/d2bin"
+	"github.com/soniakeys/digest2/internal/d2path"
+	"github.com/soniakeys/digest2/internal/d2solver"
+	"github.com/soniakeys/exit"
+	"github.com/soniakeys/mpcformat"
+	"github.com/soniakeys/observation"
+	"github.com/soniakeys/unit"
+)
+
+const versionString = "partcmp version 0.1 Go source."
+const copyrightString = "Public domain."
+
+func main() {
+	defer exit.Handler()
+
+	flag.Usage = func() {
+		os.Stderr.WriteString(`Usage:
+  partcmp [options] <model A> <model B> <obsfile>
+  partcmp -v           Display version and copyright.
+
+Options:
+`)
+		flag.PrintDefaults()
+		os.Stderr.WriteString(`
+For full documentation:
+   godoc partcmp
+`)
+	}
+	oPath := flag.String("o", "", "obscode file")
+	noid := flag.String("noid", "", "unknown model for NoID scores")
+	list := flag.Float64("list", 0, "list tracklets with a score change of n or more")
+	vers := flag.Bool("v", false, "display version and copyright")
+	flag.Parse()
+	if *vers {
+		fmt.Println(versionString)
+		fmt.Println(copyrightString)
+		os.Exit(0)
+	}
+	if flag.NArg() != 3 {
+		flag.Usage()
+		os.Exit(1)
+	}
+	arcs := readArcs(flag.Arg(2), *oPath)
+	if len(arcs) == 0 {
+		exit.Log("No tracklets in " + flag.Arg(2))
+	}
+	var sc [2][]score
+	var classes d2bin.Header
+	for m := range sc {
+		fn := flag.Arg(m)
+		model, err := d2bin.ReadFile(fn)
+		if err != nil {
+			exit.Log(err)
+		}
+		if m == 0 {
+			classes = model.Header
+		} else if !reflect.DeepEqual(model.Classes, classes.Classes) ||
+			!reflect.DeepEqual(model.ClassDefs, classes.ClassDefs) {
+			exit.Log("Models have different orbit classes")
+		}
+		g := 0
+		if *noid > "" {
+			if g = model.UnkIndex(*noid); g < 0 {
+				exit.Log("NoID model " + *noid + " not in " + fn)
+			}
+		}
+		fmt.Printf("%c: %s, partitions q %d e %d i %d h %d, NoID %s\n",
+			'A'+m, fn, len(d2bin.QPart), len(d2bin.EPart), len(d2bin.IPart),
+			len(d2bin.HPart), model.UnkGroups()[g].Name)
+		sc[m] = scoreArcs(model, g, arcs)
+	}
+	fmt.Println(len(arcs), "tracklets")
+	report(os.Stdout, sc[0], sc[1])
+	if *list > 0 {
+		listChanges(os.Stdout, arcs, sc[0], sc[1], *list)
+	}
+}
+
+// score holds raw and NoID scores of a tracklet, indexed by class.
+type score struct {
+	raw, noid []float64
+}
+
+// scoreArcs scores arcs with model, using unknown model group g for NoID
+// scores.  Arcs are scored concurrently, each with repeatable random numbers.
+func scoreArcs(model *d2bin.File, g int, arcs []*observation.Arc) []score {
+	classCompute := make([]int, len(d2bin.CList))
+	for c := range classCompute {
+		classCompute[c] = c
+	}
+	s := d2solver.New(model, classCompute, nil, unit.AngleFromSec(1))
+	sc := make([]score, len(arcs))
+	xCh := make(chan int)
+	var wg sync.WaitGroup
+	for w := runtime.GOMAXPROCS(0); w > 0; w-- {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			rnd := xrand.New(&xrand.PCGSource{})
+			for x := range xCh {
+				rnd.Seed(3)
+				_, cs, _ := s.Solve(arcs[x], vMag(arcs[x]), rnd)
+				r := score{make([]float64, len(cs)), make([]float64, len(cs))}
+				for c, s := range cs {
+					r.raw[c] = s.Raw
+					r.noid[c] = s.NoId[g]
+				}
+				sc[x] = r
+			}
+		}()
+	}
+	for x := range arcs {
+		xCh <- x
+	}
+	close(xCh)
+	wg.Wait()
+	return sc
+}
+
+// ranges are upper limits of score ranges for distributions.
+var ranges = []float64{1, 10, 50, 90, math.Inf(1)}
+
+// report writes distributions of scores and changes for each class.
+func report(w io.Writer, a, b []score) {
+	fmt.Fprintf(w, "\n%-5s %-5s %-6s %6s %6s %6s %6s %6s %6s\n",
+		"Class", "Score", "Model", "<1", "1-10", "10-50", "50-90", ">=90", "Mean")
+	for c, cl := range d2bin.CList {
+		for _, k := range []struct {
+			name string
+			get  func(score) float64
+		}{
+			{"Raw", func(s score) float64 { return s.raw[c] }},
+			{"NoID", func(s score) float64 { return s.noid[c] }},
+		} {
+			for m, sc := range [][]score{a, b} {
+				n := make([]int, len(ranges))
+				sum := 0.
+				for _, s := range sc {
+					v := k.get(s)
+					sum += v
+					r := 0
+					for v >= ranges[r] {
+						r++
+					}
+					n[r]++
+				}
+				lead := [2]string{"", ""}
+				if m == 0 {
+					lead = [2]string{cl.Abbr, k.name}
+				}
+				fmt.Fprintf(w, "%-5s %-5s %-6c", lead[0], lead[1], 'A'+m)
+				for _, nr := range n {
+					fmt.Fprintf(w, " %6d", nr)
+				}
+				fmt.Fprintf(w, " %6.1f\n", sum/float64(len(sc)))
+			}
+			var sum, max float64
+			cross := 0
+			for x := range a {
+				va, vb := k.get(a[x]), k.get(b[x])
+				d := math.Abs(vb - va)
+				sum += d
+				max = math.Max(max, d)
+				if (va >= 50) != (vb >= 50) {
+					cross++
+				}
+			}
+			fmt.Fprintf(w, "%-11s change, mean %.1f, max %.0f, %d cross 50\n",
+				"", sum/float64(len(a)), max, cross)
+		}
+	}
+}
+
+// listChanges lists tracklets with a score change of min or more.
+func listChanges(w io.Writer, arcs []*observation.Arc, a, b []score, min float64) {
+	fmt.Fprintf(w, "\nChanges of %g or more\n", min)
+	for x, arc := range arcs {
+		for c, cl := range d2bin.CList {
+			for _, k := range []struct {
+				name   string
+				va, vb float64
+			}{
+				{"Raw", a[x].raw[c], b[x].raw[c]},
+				{"NoID", a[x].noid[c], b[x].noid[c]},
+			} {
+				if math.Abs(k.vb-k.va) >= min {
+					fmt.Fprintf(w, "%7s %-3s %-4s %3.0f %3.0f\n",
+						arc.Desig, cl.Abbr, k.name, k.va, k.vb)
+				}
+			}
+		}
+	}
+}
+
+// readArcs reads observations and returns tracklets valid for scoring.
+func readArcs(obsPath, ocdPath string) (arcs []*observation.Arc) {
+	if ocdPath == "" {
+		c, _ := d2path.Find("digest2.obscodes", d2path.Data)
+		ocdPath = c.Path
+	}
+	ocdMap, err := mpcformat.ReadObscodeDatFile(ocdPath)
+	if err != nil {
+		exit.Log(err)
+	}
+	f, err := os.Open(obsPath)
+	if err != nil {
+		exit.Log(err)
+	}
+	defer f.Close()
+	for s := mpcformat.ArcSplitter(f, ocdMap); ; {
+		a, err := s()
+		switch {
+		case err == io.EOF:
+			return
+		case err != nil:
+			if _, ok := err.(mpcformat.ArcError); ok {
+				continue
+			}
+			exit.Log(err)
+		}
+		if valid(a) {
+			arcs = append(arcs, &observation.Arc{
+				Desig: a.Desig,
+				Obs:   append([]observation.VObs{}, a.Obs...),
+			})
+		}
+	}
+}
+
+// valid checks that observations make a valid arc, as digest2 does.
+func valid(a *observation.Arc) bool {
+	if len(a.Obs) < 2 {
+		return false
+	}
+	var t0 float64
+	for _, o := range a.Obs {
+		t := o.Meas().MJD
+		if t <= t0 {
+			return false
+		}
+		t0 = t
+	}
+	first := a.Obs[0].Meas()
+	last := a.Obs[len(a.Obs)-1].Meas()
+	return first.RA != last.RA || first.Dec != last.Dec
+}
+
+// vMag averages magnitudes as digest2 does, defaulting to V=21.
+func vMag(a *observation.Arc) float64 {
+	var mSum, mCount float64
+	for _, obs := range a.Obs {
+		if m := obs.Meas(); m.VMag > 0 {
+			mSum += m.VMag
+			mCount++
+		}
+	}
+	if mCount > 0 {
+		return mSum / mCount
+	}
+	return 21
+}
@@ -0,0 +1,177 @@
+// Public domain.
+
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// source is a population file listed in a manifest.
+type source struct {
+	format string  // s3m or csv
+	path   string  // file path
+	weight float64 // count per orbit
+	clipQ  float64 // orbits with q < clipQ are excluded
+	// csv options
+	cols   map[string]string // element to column name or 1-based number
+	sep    rune              // 0 for runs of white space
+	header bool
+}
+
+// defaultManifest lists the S3M files.  NEOs come only from S0.  They are
+// clipped from the other files.
+const defaultManifest = `# S3M, the Pan-STARRS Synthetic Solar System Model
+# MB
+s3m S1_00.s3m clipq=1.3
+s3m S1_01.s3m clipq=1.3
+s3m S1_02.s3m clipq=1.3
+s3m S1_03.s3m clipq=1.3
+s3m S1_04.s3m clipq=1.3
+s3m S1_05.s3m clipq=1.3
+s3m S1_06.s3m clipq=1.3
+s3m S1_07.s3m clipq=1.3
+s3m S1_08.s3m clipq=1.3
+s3m S1_09.s3m clipq=1.3
+s3m S1_10.s3m clipq=1.3
+s3m S1_11.s3m clipq=1.3
+s3m S1_12.s3m clipq=1.3
+s3m S1_13.s3m clipq=1.3
+s3m S0.s3m             # NEO
+s3m St5.s3m clipq=1.3  # Jupiter Trojan
+s3m SR.s3m clipq=1.3   # SPC
+s3m SJ.s3m clipq=1.3   # JFC
+s3m ST.s3m clipq=1.3   # TNO
+s3m SS.s3m clipq=1.3   # SDO
+`
+
+// lpcManifest lists the S3M long period comets, binned with -lpc.  They are
+// not clipped as the NEO population of S0 has no long period comets.
+const lpcManifest = `s3m SL.s3m             # LPC
+`
+
+// readManifest reads a manifest from file fn.  Relative paths in the
+// manifest are relative to the directory of the manifest.
+func readManifest(fn string) ([]*source, error) {
+	f, err := os.Open(fn)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	s, err := parseManifest(f, filepath.Dir(fn))
+	if err != nil {
+		err = fmt.Errorf("%s: %v", fn, err)
+	}
+	return s, err
+}
+
+// parseManifest parses a manifest, one source per line:
+//
+//	<format> <path> [<option>=<value> ...]
+//
+// Text following # is a comment.  Relative paths are joined to dir.
+func parseManifest(r io.Reader, dir string) (srcs []*source, err error) {
+	sc := bufio.NewScanner(r)
+	for ln := 1; sc.Scan(); ln++ {
+		l := sc.Text()
+		if x := strings.IndexByte(l, '#'); x >= 0 {
+			l = l[:x]
+		}
+		f := strings.Fields(l)
+		if len(f) == 0 {
+			continue
+		}
+		s, err := parseSource(f, dir)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", ln, err)
+		}
+		srcs = append(srcs, s)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	if len(srcs) == 0 {
+		return nil, errors.New("no sources")
+	}
+	return
+}
+
+// parseSource parses the fields of a manifest line.
+func parseSource(f []string, dir string) (*source, error) {
+	if len(f) < 2 {
+		return nil, errors.New("format and path required")
+	}
+	s := &source{format: f[0], path: f[1], weight: 1, sep: ','}
+	if s.format != "s3m" && s.format != "csv" {
+		return nil, fmt.Errorf("unknown format %q", s.format)
+	}
+	if !filepath.IsAbs(s.path) {
+		s.path = filepath.Join(dir, s.path)
+	}
+	for _, o := range f[2:] {
+		k, v := o, ""
+		if x := strings.IndexByte(o, '='); x >= 0 {
+			k, v = o[:x], o[x+1:]
+		}
+		var err error
+		switch k {
+		case "weight":
+			if s.weight, err = strconv.ParseFloat(v, 64); err == nil &&
+				s.weight <= 0 {
+				err = errors.New("not positive")
+			}
+		case "clipq":
+			s.clipQ, err = strconv.ParseFloat(v, 64)
+		case "q", "a", "e", "i", "h", "node", "peri":
+			if s.format != "csv" {
+				return nil, fmt.Errorf("option %s applies only to csv", k)
+			}
+			if s.cols == nil {
+				s.cols = map[string]string{}
+			}
+			s.cols[k] = v
+		case "sep":
+			switch v {
+			case "tab":
+				s.sep = '\t'
+			case "ws":
+				s.sep = 0
+			default:
+				if len(v) != 1 {
+					err = errors.New("a single character, tab, or ws required")
+					break
+				}
+				s.sep = rune(v[0])
+			}
+		case "header":
+			s.header = true
+		default:
+			return nil, fmt.Errorf("unknown option %q", o)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("option %s: %v", o, err)
+		}
+	}
+	if s.format == "csv" {
+		if s.cols["e"] == "" || s.cols["i"] == "" || s.cols["h"] == "" ||
+			(s.cols["q"] == "") == (s.cols["a"] == "") {
+			return nil, errors.New("csv requires columns for q or a, e, i, and h")
+		}
+		if (s.cols["node"] == "") != (s.cols["peri"] == "") {
+			return nil, errors.New("csv requires columns for both or neither" +
+				" of node and peri")
+		}
+		for _, c := range s.cols {
+			if _, err := strconv.Atoi(c); err != nil && !s.header {
+				return nil, fmt.Errorf("column name %q requires header", c)
+			}
+		}
+	}
+	return s, nil
+}
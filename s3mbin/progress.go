@@ -0,0 +1,124 @@
+// Public domain.
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"sync"
+
+	"github.com/soniakeys/digest2/internal/d2bin"
+)
+
+// stats counts orbits read.  Stats are kept per file, summed per worker, and
+// merged when workers finish.
+type stats struct {
+	orbits    int   // orbits with sane elements
+	model     int   // orbits binned in the model
+	class     []int // orbits binned, by class
+	crazy     int   // orbits with elements out of range, skipped
+	malformed int   // lines that could not be parsed, skipped
+}
+
+func newStats(nClass int) *stats {
+	return &stats{class: make([]int, nClass)}
+}
+
+// add adds counts of t to s.
+func (s *stats) add(t *stats) {
+	s.orbits += t.orbits
+	s.model += t.model
+	s.crazy += t.crazy
+	s.malformed += t.malformed
+	for c, n := range t.class {
+		s.class[c] += n
+	}
+}
+
+// progressStep is the number of orbits between progress lines.
+const progressStep = 1000000
+
+// reporter serializes progress and warning output from concurrent workers.
+type reporter struct {
+	nFiles  int
+	maxWarn int // warnings shown per file
+
+	mu   sync.Mutex
+	done int // files done
+	read int // orbits read so far, all files
+}
+
+// fileProgress tracks progress in a single file.  It is used by a single
+// worker.
+type fileProgress struct {
+	r      *reporter
+	path   string
+	s      *stats
+	unrep  int // orbits read and not yet reported to r
+	nWarn  int
+	failed bool
+}
+
+// start reports the start of reading file path.
+func (r *reporter) start(path string) *fileProgress {
+	r.mu.Lock()
+	fmt.Println("reading", path)
+	r.mu.Unlock()
+	return &fileProgress{r: r, path: path, s: newStats(len(d2bin.CList))}
+}
+
+// orbit counts an orbit read, reporting overall progress periodically.
+func (p *fileProgress) orbit() {
+	p.s.orbits++
+	if p.unrep++; p.unrep < 10000 {
+		return
+	}
+	r := p.r
+	r.mu.Lock()
+	before := r.read / progressStep
+	r.read += p.unrep
+	if r.read/progressStep > before {
+		fmt.Printf("%10d orbits, %d of %d files done\n",
+			r.read, r.done, r.nFiles)
+	}
+	r.mu.Unlock()
+	p.unrep = 0
+}
+
+// warn logs a warning for a line of the file, up to maxWarn per file.
+func (p *fileProgress) warn(ln int, msg string) {
+	if p.nWarn++; p.nWarn <= p.r.maxWarn {
+		p.r.mu.Lock()
+		log.Printf("%s:%d: %s", p.path, ln, msg)
+		p.r.mu.Unlock()
+	}
+}
+
+// fail logs an error that stopped reading the file.
+func (p *fileProgress) fail(err error) {
+	p.failed = true
+	p.r.mu.Lock()
+	log.Printf("%s: %v", p.path, err)
+	p.r.mu.Unlock()
+}
+
+// done reports counts for the file and returns them.
+func (p *fileProgress) done() *stats {
+	r := p.r
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.read += p.unrep
+	r.done++
+	if n := p.nWarn - r.maxWarn; n > 0 {
+		log.Printf("%s: %d more warnings not shown", p.path, n)
+	}
+	status := ""
+	if p.failed {
+		status = ", incomplete"
+	}
+	fmt.Printf("done %s: %d orbits, %d in model, %d crazy, %d malformed%s"+
+		" (%d of %d files, %d orbits)\n",
+		p.path, p.s.orbits, p.s.model, p.s.crazy, p.s.malformed, status,
+		r.done, r.nFiles, r.read)
+	return p.s
+}
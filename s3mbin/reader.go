@@ -0,0 +1,232 @@
+// Public domain.
+
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/soniakeys/unit"
+)
+
+// orbit holds the elements of a synthetic orbit used for binning.  Node and
+// peri are known only if angles is true.
+type orbit struct {
+	q, e       float64
+	i          unit.Angle
+	h          float64
+	node, peri unit.Angle
+	angles     bool
+}
+
+// popReader reads orbits from a population file.  Next returns io.EOF after
+// the last orbit.  A *lineError is returned for a malformed line and reading
+// can continue.  Line returns the line number of the orbit or error last
+// returned.
+type popReader interface {
+	next() (orbit, error)
+	line() int
+}
+
+// lineError is an error in the content of a line of a population file.
+type lineError struct {
+	ln  int
+	msg string
+}
+
+func (e *lineError) Error() string {
+	return fmt.Sprintf("line %d: %s", e.ln, e.msg)
+}
+
+func newLineError(ln int, format string, a ...interface{}) *lineError {
+	return &lineError{ln, fmt.Sprintf(format, a...)}
+}
+
+// newPopReader returns a reader for the format of src.
+func newPopReader(r io.Reader, src *source) (popReader, error) {
+	if src.format == "csv" {
+		return newCSVReader(r, src)
+	}
+	return &s3mReader{sc: bufio.NewScanner(r)}, nil
+}
+
+// s3mReader reads the S3M format, white space separated columns following
+// header lines that start with !!.
+type s3mReader struct {
+	sc *bufio.Scanner
+	ln int
+}
+
+func (r *s3mReader) next() (o orbit, err error) {
+	var line string
+	for {
+		if !r.sc.Scan() {
+			if err = r.sc.Err(); err == nil {
+				err = io.EOF
+			}
+			return
+		}
+		r.ln++
+		if line = r.sc.Text(); !strings.HasPrefix(line, "!!") {
+			break
+		}
+	}
+	f := strings.Fields(line)
+	if len(f) < 14 {
+		return o, newLineError(r.ln, "unexpected format: %d fields", len(f))
+	}
+	var i, node, peri float64
+	for _, p := range []struct {
+		v *float64
+		s string
+	}{{&o.q, f[2]}, {&o.e, f[3]}, {&i, f[4]}, {&node, f[5]}, {&peri, f[6]},
+		{&o.h, f[8]}} {
+		if *p.v, err = strconv.ParseFloat(p.s, 64); err != nil {
+			return o, newLineError(r.ln, "%v", err)
+		}
+	}
+	o.i = unit.AngleFromDeg(i)
+	o.node = unit.AngleFromDeg(node)
+	o.peri = unit.AngleFromDeg(peri)
+	o.angles = true
+	return
+}
+
+func (r *s3mReader) line() int { return r.ln }
+
+// csvReader reads delimited columns mapped to elements by a manifest.
+type csvReader struct {
+	read func() ([]string, error) // sets ln
+	ln   int                      // line of last record read
+	col  map[string]int           // element to 0-based column
+}
+
+func newCSVReader(r io.Reader, src *source) (*csvReader, error) {
+	cr := &csvReader{col: map[string]int{}}
+	if src.sep == 0 {
+		sc := bufio.NewScanner(r)
+		cr.read = func() ([]string, error) {
+			for sc.Scan() {
+				cr.ln++
+				l := sc.Text()
+				if l == "" || l[0] == '#' {
+					continue
+				}
+				return strings.Fields(l), nil
+			}
+			if err := sc.Err(); err != nil {
+				return nil, err
+			}
+			return nil, io.EOF
+		}
+	} else {
+		lc := &lineCounter{r: bufio.NewReader(r)}
+		c := csv.NewReader(lc)
+		c.Comma = src.sep
+		c.Comment = '#'
+		c.FieldsPerRecord = -1
+		c.TrimLeadingSpace = true
+		cr.read = func() ([]string, error) {
+			f, err := c.Read()
+			switch pe, ok := err.(*csv.ParseError); {
+			case ok:
+				cr.ln = pe.Line
+				return nil, newLineError(pe.Line, "%v", pe.Err)
+			case err == nil:
+				cr.ln = lc.n
+			}
+			return f, err
+		}
+	}
+	var header []string
+	if src.header {
+		var err error
+		if header, err = cr.read(); err != nil {
+			return nil, fmt.Errorf("header: %v", err)
+		}
+	}
+	for el, c := range src.cols {
+		if n, err := strconv.Atoi(c); err == nil {
+			if n < 1 {
+				return nil, fmt.Errorf("column %s=%d invalid", el, n)
+			}
+			cr.col[el] = n - 1
+			continue
+		}
+		x := -1
+		for hx, h := range header {
+			if strings.TrimSpace(h) == c {
+				x = hx
+				break
+			}
+		}
+		if x < 0 {
+			return nil, fmt.Errorf("column %q not in header", c)
+		}
+		cr.col[el] = x
+	}
+	return cr, nil
+}
+
+// lineCounter passes r through no more than a line at a time, counting
+// lines.  After a csv.Reader reads a record from it, n is the line the
+// record ends on.
+type lineCounter struct {
+	r    *bufio.Reader
+	rest []byte // remainder of the line being passed
+	mid  bool   // rest is not the start of a line
+	n    int    // lines started
+}
+
+func (c *lineCounter) Read(p []byte) (int, error) {
+	if len(c.rest) == 0 {
+		l, err := c.r.ReadSlice('\n')
+		if len(l) == 0 {
+			return 0, err
+		}
+		if !c.mid {
+			c.n++
+		}
+		c.rest = l
+		c.mid = l[len(l)-1] != '\n'
+	}
+	n := copy(p, c.rest)
+	c.rest = c.rest[n:]
+	return n, nil
+}
+
+func (r *csvReader) next() (o orbit, err error) {
+	f, err := r.read()
+	if err != nil {
+		return
+	}
+	v := map[string]float64{}
+	for el, x := range r.col {
+		if x >= len(f) {
+			return o, newLineError(r.ln, "%d columns, column %s not present",
+				len(f), el)
+		}
+		if v[el], err = strconv.ParseFloat(strings.TrimSpace(f[x]), 64); err != nil {
+			return o, newLineError(r.ln, "column %s: %v", el, err)
+		}
+	}
+	o.e, o.h = v["e"], v["h"]
+	o.i = unit.AngleFromDeg(v["i"])
+	if node, ok := v["node"]; ok {
+		o.node = unit.AngleFromDeg(node)
+		o.peri = unit.AngleFromDeg(v["peri"])
+		o.angles = true
+	}
+	if q, ok := v["q"]; ok {
+		o.q = q
+	} else {
+		o.q = v["a"] * (1 - o.e)
+	}
+	return
+}
+
+func (r *csvReader) line() int { return r.ln }
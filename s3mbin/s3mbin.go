@@ -1,9 +1,9 @@
 /*
-Command s3mbin generates a file, s3m.dat, for use by the program muk.
+Command s3mbin generates a file, s3m.bin, for use by the program muk.
 
-s3m.dat is distributed with the program muk, so you do not need to run
-s3mbin at all.  The program is provided for those interested in generation
-of s3m.dat.
+A text version, s3m.dat, is distributed with the program muk, so you do not
+need to run s3mbin at all.  The program is provided for those interested in
+generation of the binned model.
 
 s3mbin reads the PanSTARRS Synthetic Solar System Model (S3M) and reduces it
 to a binned model.  While the PanSTARRS S3M authors have made the complete S3M
@@ -16,17 +16,163 @@ Usage
 
 Usage:
 
-   s3mbin [output file]
+   s3mbin [-manifest <file>] [-parts <file>] [-maxwarn <n>] [-text <file>]
+          [-lpc] [-classes <file>] [output file]
    s3mbin -v
 
-The program looks in one of two places for the S3M files.  First, it checks
+Without -manifest, the program reads the S3M files.  It looks in one of two
+places for them.  First, it checks
 for an environment variable, S3M, which is set to a directory containing the
 unzipped s3m files.  If the environment variable is not set, it looks for
 a directory "s3m" in the current directory.
 
-The output file, s3m.dat, by default is generated in the path "../muk" relative
-to the s3mbin source directory.  Alternatively the output path or file name
-can be specified as a command line argument.
+The output file, s3m.bin, by default is generated in the first directory
+listed in the environment variable DIGEST2_PATH or if that is not set, in
+the XDG data directory where muk looks for it first, typically
+~/.local/share/digest2.  Alternatively the output path or file name can be
+specified as a command line argument.
+
+Files are read concurrently.  The program shows each file as it is started
+and finished, with counts of orbits read, binned in the model, and skipped,
+and periodically shows the overall count of orbits read.  Malformed lines
+and lines with crazy data, such as negative perihelion distance or
+eccentricity over 1.1, are skipped with a warning giving the file and line
+number.  At most -maxwarn warnings, default 10, are shown for each file.
+
+Output format
+
+The output file is binary, in a versioned format like that of the digest2
+model file.  It holds the partitions, orbit classes, the list of files
+binned, and the bin values, with a checksum.  With -text, the model is also
+written in the text format of s3m.dat to the given file.  The text format is readable and suitable for distribution
+with the source code.  muk reads either format.
+
+Partitions
+
+Orbits are binned by q, e, i, and H.  The bin limits, or partitions, can be
+given in a spec file with -parts.  The file has a line for each element
+giving the element and its upper bin limits in increasing order, with
+inclination in degrees.  Lines starting with # are comments.  The default
+partitions are
+
+   q .4 .7 .8 .9 1 1.017 1.1 1.2 1.3 1.4 1.5 1.67 1.8 2 2.2 2.4 2.6
+     2.8 3 3.2 3.5 4 4.5 5 5.2 5.5 10 20 25 30 40 100
+   e .1 .2 .3 .4 .5 .7 .9 1.1
+   i 2 5 10 15 20 25 30 40 60 90 180
+   h 4 5 6 7 8 9 10 11 12 13 14 15 16 17 18 19 20 21 22 23 24 25.5
+
+where the q line is shown wrapped.  The q limit at 1.017 AU is the boundary
+between Apollos, with q < 1.017, and Amors, with q > 1.017.  The other NEO
+groups are bounded by aphelion distance Q = .983 AU, between Atiras and
+Atens, and by a = 1 AU, between Atens and Apollos.  These boundaries are
+curves in q and e and no q or e limit resolves them.  Bins of q < 1 straddle
+them and Atira, Aten, and Apollo scores of orbits near the boundaries are
+approximate.  The q limits at 5.2 and 25 AU are boundaries of the
+outer solar system classes.  Centaurs have q >= 5.2 and scattered disk
+objects q >= 25.  H limits from 4 to 9 resolve the bright, distant Centaurs
+and trans-Neptunian objects of the S3M files ST.s3m and SS.s3m.  Orbits at
+or beyond the last q, e, or i limit are outside the model.  The last H bin
+includes all fainter objects.  The partitions are written to the output
+file, from which muk carries them into the model file.  Command partcmp
+compares scores from models with different partitions.
+
+Long period comets
+
+The S3M long period comet file, SL.s3m, is not binned by default.  Option -lpc
+adds it to the default manifest and adds the orbit class LPC, long period
+comets, to the model.  With -manifest and -lpc, list the long period comet
+population in the manifest with a suitable weight, for example
+
+   s3m SL.s3m weight=1
+
+Without -lpc, the LPC class is not in the model and digest2 does not score
+it.  Long period comets are not clipped at q < 1.3 as the S0 NEO population
+has no long period comets.  Most have e < 1.1 and are within the model, but
+in a single e bin of .9 to 1.1 with the default partitions.  A partition
+spec with finer e bins near 1 gives better resolution for comet-like
+tracklets.
+
+Manifest
+
+Other synthetic population models can be binned by listing their files in
+a manifest given with -manifest.  Each line gives a format, a file path, and
+options:
+
+   <format> <path> [<option>=<value> ...]
+
+Text following # is a comment.  A relative path is relative to the directory
+of the manifest.  The formats are
+
+   s3m   the S3M format, white space separated columns following !! lines
+   csv   delimited columns, mapped to elements with options
+
+Options for any format are
+
+   weight=<w>   each orbit counts w, default 1
+   clipq=<q>    orbits with perihelion distance less than q are excluded
+
+Clipping allows one source to supply all NEOs.  The default manifest, used
+without -manifest, clips NEOs, q < 1.3, from all S3M files except S0.
+
+Options for csv are
+
+   q=<col>      perihelion distance, AU
+   a=<col>      semimajor axis, AU, if q is not given
+   e=<col>      eccentricity
+   i=<col>      inclination, degrees
+   h=<col>      absolute magnitude H
+   node=<col>   longitude of ascending node, degrees, J2000 ecliptic
+   peri=<col>   argument of perihelion, degrees
+   header       the first record is a header of column names
+   sep=<c>      column separator, a single character, tab, or ws for runs
+                of white space.  The default is a comma.
+
+A column is a 1-based column number or, with header, a column name.  Lines
+starting with # are skipped.
+
+The node and argument of perihelion are needed for the Earth MOID, minimum
+orbit intersection distance, which defines the class PHA, potentially
+hazardous asteroids.  They are read from S3M files.  For a csv source
+without node and peri columns, the MOID is unknown.  Orbits of the source
+are not binned in PHA, and comparisons with MOID in class definitions are
+false for them, as comparisons with NaN are in Go.  For example,
+
+   s3m S0.s3m
+   csv neomod.csv header a=a e=e i=i h=H weight=0.5
+
+Defined classes
+
+Orbit classes in addition to the built in classes can be defined in a file
+given with -classes.  Each line defines a class with an abbreviation of up
+to three characters, a heading in double quotes, and a condition on orbital
+elements:
+
+   <abbr> "<heading>" <expression>
+
+Lines starting with # are comments.  The expression can use
+
+   q   perihelion distance, AU
+   e   eccentricity
+   i   inclination, degrees
+   H   absolute magnitude, also h
+   a   semimajor axis, AU
+   Q   aphelion distance, AU
+   Tj  Tisserand parameter with respect to Jupiter
+   MOID  Earth minimum orbit intersection distance, AU
+
+with numbers, arithmetic + - * /, comparisons < <= > >= == !=, logical
+operators && || !, and parentheses, with precedence as in Go.  For example,
+
+   # NEOs with high inclination
+   NHi "NEO(i > 40)" q < 1.3 && i > 40
+   # Jupiter crossers
+   JX  "Jupiter cross." q < 5.2 && Q > 5.2
+   # NEOs passing close to the Earth orbit
+   NEC "Near Earth orb." q < 1.3 && MOID < .01
+
+The definitions are written to the output file with the bins.  muk carries
+them into the model file, and digest2 accepts them in the configuration
+file like the built in classes.
 
 -------------
 Public domain.
@@ -34,175 +180,121 @@ Public domain.
 package main
 
 import (
-	"bufio"
 	"flag"
 	"fmt"
-	"go/build"
 	"io"
-	"log"
 	"os"
 	"path/filepath"
 	"runtime"
-	"strconv"
 	"strings"
 
 	"github.com/soniakeys/digest2/internal/d2bin"
+	"github.com/soniakeys/digest2/internal/d2path"
 	"github.com/soniakeys/exit"
 	"github.com/soniakeys/unit"
 )
 
-const parentImport = "digest2"
 const versionString = "s3mbin version 0.2"
 const copyrightString = "Public domain."
 
 // Orbits are binned in four dimensions of q, e, i, and H.
-// The partitions in each dimension vary in size.
-
-func init() {
-	d2bin.QPart = []float64{.4, .7, .8, .9, 1, 1.1, 1.2, 1.3,
-		1.4, 1.5, 1.67, 1.8, 2, 2.2, 2.4, 2.6, 2.8, 3,
-		3.2, 3.5, 4, 4.5, 5, 5.5, 10, 20, 30, 40, 100}
-	d2bin.EPart = []float64{.1, .2, .3, .4, .5, .7, .9, 1.1}
-	iParts := []float64{2, 5, 10, 15, 20, 25, 30, 40, 60, 90, 180}
-	d2bin.IPart = make([]unit.Angle, len(iParts))
-	for i, d := range iParts {
-		d2bin.IPart[i] = unit.AngleFromDeg(d)
-	}
-	d2bin.HPart = []float64{6, 8, 10, 11, 12, 13, 14, 15,
-		16, 17, 18, 19, 20, 21, 22, 23, 24, 25.5}
-	d2bin.MSize = len(d2bin.QPart) * len(d2bin.EPart) *
-		len(d2bin.IPart) * len(d2bin.HPart)
-	d2bin.LastH = len(d2bin.HPart) - 1
+// The partitions in each dimension vary in size.  These are the defaults,
+// which can be replaced with -parts.
+const defaultPartitions = `q .4 .7 .8 .9 1 1.017 1.1 1.2 1.3 1.4 1.5 1.67 1.8 2 2.2 2.4 2.6 2.8 3 3.2 3.5 4 4.5 5 5.2 5.5 10 20 25 30 40 100
+e .1 .2 .3 .4 .5 .7 .9 1.1
+i 2 5 10 15 20 25 30 40 60 90 180
+h 4 5 6 7 8 9 10 11 12 13 14 15 16 17 18 19 20 21 22 23 24 25.5
+`
+
+// result is the binned model and stats from a worker.
+type result struct {
+	m *d2bin.Model
+	s *stats
 }
 
-func readPart(fCh chan string, mCh chan *d2bin.Model) {
-	m := d2bin.New()
-	for f := range fCh {
-		binS3m(m, f, f != "S0")
+func readPart(sCh chan *source, rCh chan result, rp *reporter) {
+	r := result{d2bin.New(), newStats(len(d2bin.CList))}
+	for src := range sCh {
+		r.s.add(binSource(r.m, src, rp))
 	}
-	mCh <- m
+	rCh <- r
 }
 
-var nl bool
-var nOrbits, nModel int
-var nClass = make([]int, len(d2bin.CList))
-var s3mPath string
-
-func binS3m(m *d2bin.Model, fn string, clipNeo bool) {
-	fn = filepath.Join(s3mPath, fn+".s3m")
-	if nl {
-		fmt.Println()
-		nl = false
-	}
-	fmt.Println(fn)
-	f, err := os.Open(fn)
+// binSource bins orbits of src into m.  Malformed lines and crazy data are
+// skipped with a warning.
+func binSource(m *d2bin.Model, src *source, rp *reporter) *stats {
+	p := rp.start(src.path)
+	f, err := os.Open(src.path)
 	if err != nil {
-		log.Println(err)
-		return
+		p.fail(err)
+		return p.done()
 	}
 	defer f.Close()
 
-	bf := bufio.NewReader(f)
-	var line string
-	for {
-		if line, err = bf.ReadString('\n'); err != nil {
-			log.Println(err)
-			return
-		}
-		if !strings.HasPrefix(line, "!!") {
-			break
-		}
+	pr, err := newPopReader(f, src)
+	if err != nil {
+		p.fail(err)
+		return p.done()
 	}
-	var q, e, h float64
-	var i unit.Angle
 	i180 := unit.AngleFromDeg(180)
-loop:
 	for {
-		f := strings.Fields(line)
-		if len(f) < 14 {
-			fmt.Println("unexpected format:", len(f), "fields")
-			return
-		}
-		if q, err = strconv.ParseFloat(f[2], 64); err != nil {
-			break
-		}
-		if e, err = strconv.ParseFloat(f[3], 64); err != nil {
-			break
-		}
-		if d, err := strconv.ParseFloat(f[4], 64); err != nil {
-			break
-		} else {
-			i = unit.AngleFromDeg(d)
-		}
-		if h, err = strconv.ParseFloat(f[8], 64); err != nil {
-			break
+		o, err := pr.next()
+		switch le, ok := err.(*lineError); {
+		case err == io.EOF:
+			return p.done() // normal return
+		case ok:
+			p.s.malformed++
+			p.warn(le.ln, le.msg)
+			continue
+		case err != nil:
+			p.fail(err)
+			return p.done()
 		}
+		q, e, i, h := o.q, o.e, o.i, o.h
 		if q <= 0 || e < 0 || e > 1.1 || i < 0 || i >= i180 {
-			goto read // crazy data
+			p.s.crazy++
+			p.warn(pr.line(), fmt.Sprintf("crazy data: q %.6g e %.6g i %.6g",
+				q, e, i.Deg()))
+			continue
 		}
-		nOrbits++
-		if nOrbits%100000 == 0 {
-			fmt.Print(".")
-			nl = true
-		}
-		if clipNeo && q < 1.3 {
-			goto read // bad data
+		p.orbit()
+		if q < src.clipQ {
+			continue // clipped
 		}
 		if iq, ie, ii, ih, inModel := d2bin.Qeih(q, e, i, h); inModel {
-			nModel++
+			p.s.model++
 			x := d2bin.Mx(iq, ie, ii, ih)
-			m.SS[x]++
+			m.SS[x] += src.weight
+			do := &d2bin.Orbit{Q: q, E: e, I: i, H: h,
+				Node: o.node, Peri: o.peri, Angles: o.angles}
 			for c, cs := range d2bin.CList {
-				if cs.IsClass(q, e, i, h) {
-					nClass[c]++
-					m.Class[c][x]++
+				if cs.IsClass(do) {
+					p.s.class[c]++
+					m.Class[c][x] += src.weight
 				}
 			}
 		}
-	read:
-		line, err = bf.ReadString('\n')
-		switch err {
-		case nil:
-		case io.EOF:
-			if len(line) == 0 {
-				return // normal return
-			}
-		default:
-			break loop
-		}
 	}
-	log.Println(err)
-}
-
-var s3mFiles = []string{
-	// MB
-	"S1_00", "S1_01", "S1_02", "S1_03", "S1_04", "S1_05", "S1_06",
-	"S1_07", "S1_08", "S1_09", "S1_10", "S1_11", "S1_12", "S1_13",
-	"S0",  // NEO
-	"St5", // Jupiter Trojan
-	"SR",  // SPC
-	"SJ",  // JFC
-	"ST",  // TNO
-	"SS",  // SDO
-	//	"SL",   // LPC.  Don't include.
 }
 
 func main() {
 	defer exit.Handler()
-	// parent dir of s3mbin, muk, etc.
-	parentDir := ""
-	if pkg, err := build.Import(parentImport, "", build.FindOnly); err == nil {
-		parentDir = pkg.Dir
-	}
 	flag.Usage = func() {
 		os.Stderr.WriteString(`Usage:
-   s3mbin [output file]
+   s3mbin [-manifest <file>] [-parts <file>] [-maxwarn <n>] [-text <file>]
+          [-lpc] [-classes <file>] [output file]
    s3mbin -v
 
 For full documentation:
    godoc s3mbin
 `)
 	}
+	manifest := flag.String("manifest", "", "population manifest file")
+	parts := flag.String("parts", "", "partition spec file")
+	maxWarn := flag.Int("maxwarn", 10, "warnings shown per file")
+	text := flag.String("text", "", "also write the model in text format to file")
+	lpc := flag.Bool("lpc", false, "include long period comets")
+	classFile := flag.String("classes", "", "class definition file")
 	vers := flag.Bool("v", false, "display version and copyright")
 	flag.Parse()
 	if *vers {
@@ -221,48 +313,117 @@ For full documentation:
 		flag.Usage()
 		os.Exit(1)
 	}
-	if outDir == "" {
-		outDir = filepath.Join(parentDir, "muk")
-	}
 	if outFile == "" {
-		outFile = d2bin.Sfn
+		outFile = d2bin.Sbfn
+	}
+	if outDir == "" {
+		outDir, _ = filepath.Split(d2path.Default(outFile, d2path.Data).Path)
+		if err := os.MkdirAll(outDir, 0755); err != nil {
+			exit.Log(err)
+		}
 	}
 
-	// determine s3m directory
-	s3mPath = os.Getenv("S3M")
-	if s3mPath == "" {
-		s3mPath = filepath.Join(".", "s3m")
+	// partitions
+	var p *d2bin.Partitions
+	var err error
+	if *parts > "" {
+		f, err := os.Open(*parts)
+		if err != nil {
+			exit.Log(err)
+		}
+		p, err = d2bin.ParsePartitions(f)
+		f.Close()
+		if err != nil {
+			exit.Log(fmt.Errorf("%s: %v", *parts, err))
+		}
+	} else if p, err = d2bin.ParsePartitions(
+		strings.NewReader(defaultPartitions)); err != nil {
+		exit.Log(err)
 	}
+	p.Set()
 
-	// a quick check that the s3mPath is there
-	if _, err := os.Stat(s3mPath); err != nil {
+	// classes.  the LPC class is binned only with the LPC population.
+	var classes []string
+	for _, c := range d2bin.Classes {
+		if c.Abbr != "LPC" || *lpc {
+			classes = append(classes, c.Abbr)
+		}
+	}
+	var defs []d2bin.ClassDef
+	if *classFile > "" {
+		f, err := os.Open(*classFile)
+		if err != nil {
+			exit.Log(err)
+		}
+		defs, err = d2bin.ParseClassDefs(f)
+		f.Close()
+		if err != nil {
+			exit.Log(fmt.Errorf("%s: %v", *classFile, err))
+		}
+		for _, d := range defs {
+			classes = append(classes, d.Abbr)
+		}
+	}
+	if err := d2bin.SetClasses(classes, defs); err != nil {
 		exit.Log(err)
 	}
 
-	// a source of file names
-	fCh := make(chan string)
+	// population sources from the manifest, or by default the S3M files
+	var srcs []*source
+	if *manifest > "" {
+		if srcs, err = readManifest(*manifest); err != nil {
+			exit.Log(err)
+		}
+	} else {
+		// determine s3m directory
+		s3mPath := os.Getenv("S3M")
+		if s3mPath == "" {
+			s3mPath = filepath.Join(".", "s3m")
+		}
+
+		// a quick check that the s3mPath is there
+		if _, err := os.Stat(s3mPath); err != nil {
+			exit.Log(err)
+		}
+		var err error
+		m := defaultManifest
+		if *lpc {
+			m += lpcManifest
+		}
+		srcs, err = parseManifest(strings.NewReader(m), s3mPath)
+		if err != nil {
+			exit.Log(err)
+		}
+	}
+
+	// a source of sources
+	sCh := make(chan *source)
 	go func() {
-		for _, f := range s3mFiles {
-			fCh <- f
+		for _, s := range srcs {
+			sCh <- s
 		}
-		close(fCh)
+		close(sCh)
 	}()
 
 	// start a number of file readers in parallel.
-	// each returns a data set on mCh
-	mCh := make(chan *d2bin.Model)
+	// each returns a data set and stats on rCh
+	rCh := make(chan result)
+	rp := &reporter{nFiles: len(srcs), maxWarn: *maxWarn}
 	nProc := runtime.GOMAXPROCS(0)
-	if nProc > len(s3mFiles) {
-		nProc = len(s3mFiles)
+	if nProc > len(srcs) {
+		nProc = len(srcs)
 	}
 	for i := 0; i < nProc; i++ {
-		go readPart(fCh, mCh)
+		go readPart(sCh, rCh, rp)
 	}
 
 	// combine data sets from readers
 	s3m := d2bin.New()
+	st := newStats(len(d2bin.CList))
 	for i := 0; i < nProc; i++ {
-		mp := <-mCh
+		r := <-rCh
+		st.add(r.s)
+		mp := r.m
 		for x, c := range mp.SS {
 			s3m.SS[x] += c
 		}
@@ -275,66 +436,43 @@ For full documentation:
 	}
 
 	// show status
-	if nl {
-		fmt.Println()
+	fmt.Println(st.orbits, "orbits")
+	fmt.Println(st.model, "in model")
+	if st.crazy > 0 || st.malformed > 0 {
+		fmt.Println(st.crazy, "crazy,", st.malformed, "malformed, skipped")
 	}
-	fmt.Println(nOrbits, "orbits")
-	fmt.Println(nModel, "in model")
-	for c, nc := range nClass {
+	for c, nc := range st.class {
 		fmt.Printf("%8d %s\n", nc, d2bin.CList[c].Heading)
 	}
 
 	// write results
-	f, err := os.Create(filepath.Join(outDir, outFile))
-	if err != nil {
-		exit.Log(err)
-	}
-	if _, err = f.WriteString("S3M binned"); err != nil {
-		f.Close()
-		exit.Log(err) // catch error on first write
-	}
-
-	f.WriteString("\nq")
-	for _, part := range d2bin.QPart {
-		fmt.Fprintf(f, " %g", part) // ignore errors in the middle
+	h := d2bin.S3MHeader{Orbits: st.orbits}
+	for _, src := range srcs {
+		h.Sources = append(h.Sources, src.path)
 	}
-	f.WriteString("\ne")
-	for _, part := range d2bin.EPart {
-		fmt.Fprintf(f, " %g", part)
-	}
-	f.WriteString("\ni")
-	for _, part := range d2bin.IPart {
-		fmt.Fprintf(f, " %g", part)
-	}
-	f.WriteString("\nh")
-	for _, part := range d2bin.HPart {
-		fmt.Fprintf(f, " %g", part)
+	if err := writeFile(filepath.Join(outDir, outFile), func(w io.Writer) error {
+		return d2bin.WriteS3M(w, h, s3m)
+	}); err != nil {
+		exit.Log(err)
 	}
-	f.WriteString("\n")
-
-	for i := 0; i < len(s3m.SS); {
-		for _ = range d2bin.HPart {
-			fmt.Fprintf(f, "%g ", s3m.SS[i])
-			i++
+	if *text > "" {
+		if err := writeFile(*text, func(w io.Writer) error {
+			return d2bin.WriteS3MText(w, s3m)
+		}); err != nil {
+			exit.Log(err)
 		}
-		f.WriteString("\n")
 	}
+}
 
-	for cx, class := range s3m.Class {
-		fmt.Fprintf(f, "%s\n", d2bin.CList[cx].Heading)
-		for i := 0; i < len(class); {
-			for _ = range d2bin.HPart {
-				fmt.Fprintf(f, "%g ", class[i])
-				i++
-			}
-			_, err = f.WriteString("\n")
-		}
+// writeFile creates file fn and writes it with write.
+func writeFile(fn string, write func(io.Writer) error) error {
+	f, err := os.Create(fn)
+	if err != nil {
+		return err
 	}
-	if err != nil { // print error on last write
+	if err = write(f); err != nil {
 		f.Close()
-		exit.Log(err)
-	}
-	if err := f.Close(); err != nil {
-		exit.Log(err)
+		return err
 	}
+	return f.Close()
 }